@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/khrm/smap/internal/sitemap"
+)
+
+// writeReport writes the broken links along with the pages
+// leading to them to w, then the links to missing fragments
+func writeReport(w io.Writer, broken []sitemap.BrokenLink,
+	fragments []sitemap.BrokenFragment) {
+	for _, b := range broken {
+		reason := b.Error
+		if reason == "" {
+			reason = strconv.Itoa(b.Status)
+		}
+		kind := "internal"
+		if b.External {
+			kind = "external"
+		}
+		fmt.Fprintf(w, "%s (%s): %s\n", b.URL, kind, reason)
+		for _, src := range b.Sources {
+			switch {
+			case src.Type == sitemap.EdgeRedirect:
+				fmt.Fprintf(w, "\tredirected from %s\n", src.Page)
+			case src.Text != "":
+				fmt.Fprintf(w, "\tlinked from %s as %q\n", src.Page,
+					src.Text)
+			default:
+				fmt.Fprintf(w, "\tlinked from %s\n", src.Page)
+			}
+		}
+	}
+	for _, f := range fragments {
+		fmt.Fprintf(w, "%s#%s (fragment): no such anchor\n", f.URL,
+			f.Fragment)
+		if f.Text != "" {
+			fmt.Fprintf(w, "\tlinked from %s as %q\n", f.Page, f.Text)
+		} else {
+			fmt.Fprintf(w, "\tlinked from %s\n", f.Page)
+		}
+	}
+	fmt.Fprintf(w, "%d broken links, %d broken fragments\n", len(broken),
+		len(fragments))
+}
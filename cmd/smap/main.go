@@ -1,18 +1,33 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/khrm/smap/internal/checkpoint"
 	"github.com/khrm/smap/internal/crawler"
+	"github.com/khrm/smap/internal/linkcheck"
+	"github.com/khrm/smap/internal/normalize"
 	"github.com/khrm/smap/internal/parser"
+	"github.com/khrm/smap/internal/retry"
+	"github.com/khrm/smap/internal/robots"
+	"github.com/khrm/smap/internal/scope"
+	"github.com/khrm/smap/internal/seed"
+	"github.com/khrm/smap/internal/sitemap"
+	"github.com/khrm/smap/internal/throttle"
 )
 
 var (
@@ -26,60 +41,477 @@ var (
 			TLSHandshakeTimeout:   10 * time.Second,
 			ResponseHeaderTimeout: 10 * time.Second,
 		},
+		// Redirections are followed by parser to record them
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
 	}
 )
 
 func main() {
+	// smap check crawls as a link checker, it reports broken links
+	// instead of the sitemap
+	checkMode := len(os.Args) > 1 && os.Args[1] == "check"
+	args := os.Args[1:]
+	if checkMode {
+		args = args[1:]
+	}
+
 	// Getting configuration
 	domain := flag.String("domain", "goharbor.io", "domain to crawl")
+	seedList := flag.String("seeds", "", "comma separated urls to crawl"+
+		" from, instead of -domain")
+	seedFile := flag.String("seedfile", "", "file listing urls to crawl"+
+		" from, one per line, instead of -domain")
 	depth := flag.Int("depth", -1, "depth to crawl")
 	concurrent := flag.Uint("concurrent", 3, "nbrof concurrent request")
-	root := flag.Bool("root", true, "restrict to only domain given")
+	hostConcurrent := flag.Int("hostconcurrent", 2, "nbr of concurrent"+
+		" requests to a host, 0 for no limit")
+	rps := flag.Float64("rps", 0, "requests per second to a host,"+
+		" 0 for no limit")
+	minDelay := flag.Duration("mindelay", 0, "minimum delay between"+
+		" requests to a host")
+	adaptive := flag.Bool("adaptive", true, "slow down on hosts whose"+
+		" response time climbs")
+	maxDelay := flag.Duration("maxdelay", time.Minute, "maximum delay"+
+		" between requests to a host when backing off on 429/503")
+	attempts := flag.Int("attempts", 3, "nbr of tries of a url failing"+
+		" with a timeout or a 5xx, 429 or 408 status")
+	retryBackoff := flag.Duration("retrybackoff", time.Second, "wait"+
+		" before the first retry, doubled on every retry")
+	stateDir := flag.String("state", "", "directory where the crawl"+
+		" state is saved so that it can be resumed")
+	every := flag.Duration("checkpoint", time.Minute, "interval between"+
+		" two saves of the crawl state in -state")
+	resume := flag.Bool("resume", false, "continue the crawl saved in"+
+		" -state")
+	previous := flag.String("previous", "", "json output of a previous"+
+		" crawl, its pages are fetched conditionally and changes are"+
+		" reported")
+	external := flag.Bool("external", false, "check links to urls out"+
+		" of the crawl scope with HEAD, then GET if it fails")
+	externalConcurrent := flag.Uint("externalconcurrent", 2, "nbr of"+
+		" external links checked in parallel")
+	externalDelay := flag.Duration("externaldelay", time.Second,
+		"minimum delay between checks of links to the same external host")
+	linkCache := flag.String("linkcache", "", "file where results of"+
+		" external link checks are kept between runs")
+	linkCacheTTL := flag.Duration("linkcachettl", 24*time.Hour, "time"+
+		" for which a result of -linkcache is reused")
+	threshold := flag.Int("threshold", 0, "nbr of broken links and"+
+		" fragments tolerated by check before it exits with status 1")
+	root := flag.Bool("root", true, "restrict to urls in -scope, "+
+		"false follows links to any host")
+	scopeName := flag.String("scope", "host", "urls to crawl: host,"+
+		" subdomains, domain (registrable domain) or hosts (-hosts list)")
+	hosts := flag.String("hosts", "", "comma separated hosts crawled"+
+		" with -scope=hosts")
+	prefix := flag.String("prefix", "", "restrict crawl to urls under"+
+		" this path prefix")
 	debug := flag.Bool("debug", false, "whether to print everything")
 	scheme := flag.String("scheme", "https",
 		"scheme of the domain like http")
 	stdXMLSiteMap := flag.Bool("stdsmap", true, "whether to"+
 		" print standard sitemap xml")
+	respectRobots := flag.Bool("robots", true, "whether to respect"+
+		" robots.txt rules and crawl-delay")
+	userAgent := flag.String("useragent", "smap", "user agent sent"+
+		" with requests and matched against robots.txt")
+	follow := flag.String("follow", strings.Join(crawler.DefaultFollow, ","),
+		"comma separated elements whose links are crawled, links of"+
+			" other elements are recorded as resources")
+	norm := flag.String("normalize", strings.Join(normalize.DefaultNames, ","),
+		"comma separated url normalization rules among "+
+			strings.Join(normalize.Names, ","))
+	nofollow := flag.Bool("nofollow", false, "don't crawl links of"+
+		" nofollow pages and rel=nofollow links")
+	maxChain := flag.Int("maxchain", 3, "report redirect chains longer"+
+		" than this, 0 disables it")
+	depthPriority := flag.Bool("depthpriority", false, "compute sitemap"+
+		" priority from click depth when no -priority rule matches")
+	images := flag.Bool("images", true, "add image:image entries to the"+
+		" sitemap")
+	videos := flag.Bool("videos", true, "add video:video entries to the"+
+		" sitemap")
+	news := flag.Bool("news", false, "add news:news entries to the"+
+		" sitemap for pages declaring a publication date")
+	newsName := flag.String("newsname", "", "publication name of news"+
+		" pages which don't declare og:site_name")
+	hreflang := flag.Bool("hreflang", true, "add xhtml:link entries for"+
+		" hreflang alternates to the sitemap")
+	var changeFreqs, priorities stringList
+	flag.Var(&changeFreqs, "changefreq", "regexp=changefreq rule for"+
+		" sitemap urls, can be repeated")
+	flag.Var(&priorities, "priority", "regexp=priority rule for sitemap"+
+		" urls, can be repeated")
+	outDir := flag.String("out", "", "directory where sitemap files and"+
+		" their index are written instead of printing the sitemap")
+	baseURL := flag.String("baseurl", "", "url where -out files are"+
+		" published, defaults to the root of the domain")
+	gz := flag.Bool("gzip", false, "gzip sitemap files written in -out")
+	group := flag.Bool("group", false, "split sitemap files written in"+
+		" -out by first path section")
+	seedSitemaps := flag.Bool("seedsitemaps", false, "crawl urls of"+
+		" sitemaps announced in robots.txt (or /sitemap.xml) which aren't"+
+		" linked, they are marked as orphans")
+	format := flag.String("format", "json", "output printed: json (with"+
+		" the standard sitemap) or the link graph as dot, graphml, gexf"+
+		" or mermaid")
+	clusterDepth := flag.Int("cluster", 0, "group nodes of the link graph"+
+		" by host and first path segments, i.e. 1 for ex.io/docs")
+	var sitemaps stringList
+	flag.Var(&sitemaps, "sitemap", "url of a sitemap to seed the crawl"+
+		" from, can be repeated")
+	var include, exclude stringList
+	flag.Var(&include, "include", "regexp (or glob:pattern) of urls to"+
+		" crawl, can be repeated")
+	flag.Var(&exclude, "exclude", "regexp (or glob:pattern) of urls not"+
+		" to crawl, can be repeated")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"Usage: %s [check] [flags]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.CommandLine.Parse(args)
+
+	graph := sitemap.Format(*format)
+	if graph != "json" {
+		// an unknown format is refused before crawling
+		err := sitemap.New().Export(ioutil.Discard, graph, nil)
+		if errors.Is(err, sitemap.ErrUnknownFormat) {
+			log.Fatalln(err)
+		}
+		// keep the graph printed on stdout readable by other tools
+		logger.SetOutput(os.Stderr)
+	}
+
+	httpClient.Transport = &userAgentTransport{
+		agent: *userAgent,
+		rt:    httpClient.Transport,
+	}
 
-	flag.Parse()
+	client := throttle.New(httpClient, throttle.Config{
+		MaxPerHost: *hostConcurrent,
+		RPS:        *rps,
+		MinDelay:   *minDelay,
+		Adaptive:   *adaptive,
+		MaxDelay:   *maxDelay,
+	}, logger, *debug)
 
-	p := parser.New(httpClient, logger, *debug, *concurrent)
+	p := parser.New(client, logger, *debug, *concurrent)
 
 	if *depth == -1 {
 		depth = nil
 	}
 
-	c := crawler.NewConfig(*root, depth, *debug)
-	u, err := url.Parse(*domain)
+	c := crawler.NewConfig(*root, depth, *debug).WithWorkers(*concurrent).
+		WithFollow(strings.Split(*follow, ",")...).
+		WithMaxRedirectChain(*maxChain).WithNofollow(*nofollow).
+		WithRetry(retry.New(*attempts, *retryBackoff))
+	if *respectRobots {
+		c.WithRobots(robots.NewCache(client, *userAgent, logger,
+			*debug)).WithThrottle(client)
+	}
+	if *seedSitemaps || len(sitemaps) > 0 {
+		c.WithSitemapSeeds(seed.NewLoader(client, logger, *debug),
+			sitemaps...)
+	}
+	seeds, err := readSeeds(*domain, *seedList, *seedFile, *scheme)
 	if err != nil {
-		log.Println("Failed")
+		log.Fatalln(err)
+	}
+	u := seeds[0]
+	c.WithSeeds(seeds[1:]...)
 
+	n, err := normalize.ByName(strings.Split(*norm, ",")...)
+	if err != nil {
+		log.Fatalln(err)
 	}
+	c.WithNormalizer(n)
 
-	if u.Scheme == "" {
-		u.Scheme = *scheme
+	sc, err := newScope(*scopeName, seeds, *hosts, *prefix, *root)
+	if err != nil {
+		log.Fatalln(err)
 	}
+	c.WithScope(sc)
 
-	if u.Host == "" {
-		u.Host = u.Path
-		u.Path = ""
+	if len(include) > 0 || len(exclude) > 0 {
+		f, err := scope.NewFilter(include, exclude)
+		if err != nil {
+			log.Fatalln("invalid pattern:", err)
+		}
+		c.WithFilter(f)
 	}
 
-	crawl := crawler.New(u, p, logger, c)
+	if *resume && *stateDir == "" {
+		log.Fatalln("-resume needs -state")
+	}
+	if *stateDir != "" {
+		st := checkpoint.New(*stateDir)
+		c.WithCheckpoint(st, *every)
+		if *resume {
+			state, err := st.Load()
+			switch {
+			case errors.Is(err, os.ErrNotExist):
+				logger.Println("no crawl saved in", *stateDir,
+					"starting a new one")
+			case err != nil:
+				log.Fatalln("error loading crawl state", err)
+			default:
+				c.WithResume(state)
+			}
+		}
+	}
 
-	sm := crawl.Start()
+	var cache *linkcheck.Cache
+	if *external {
+		// External hosts are checked one request at a time
+		ext := throttle.New(httpClient, throttle.Config{
+			MaxPerHost: 1,
+			MinDelay:   *externalDelay,
+			Adaptive:   true,
+			MaxDelay:   *maxDelay,
+		}, logger, *debug)
+		ch := linkcheck.New(ext, logger, *debug)
+		if *linkCache != "" {
+			cache, err = linkcheck.NewCache(*linkCache, *linkCacheTTL)
+			if err != nil {
+				log.Fatalln("error loading link cache", err)
+			}
+			ch.WithCache(cache)
+		}
+		c.WithExternalCheck(ch, *externalConcurrent)
+	}
 
-	data, err := json.MarshalIndent(sm, "  ", "    ")
+	var prev *sitemap.SiteMap
+	if *previous != "" {
+		prev, err = loadSiteMap(*previous)
+		if err != nil {
+			log.Fatalln("error loading previous crawl", err)
+		}
+		c.WithPrevious(prev)
+	}
+
+	xc, err := newXMLConfig(changeFreqs, priorities, *depthPriority)
 	if err != nil {
-		log.Println("error marshaling data to json", err)
+		log.Fatalln(err)
+	}
+	xc.Images, xc.Videos = *images, *videos
+	xc.News, xc.NewsPublication = *news, *newsName
+	xc.Alternates = *hreflang
+
+	// First SIGINT/SIGTERM stops the crawl and prints what was
+	// collected, a second one kills the program
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt,
+		syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	crawl := crawler.New(u, p, logger, c)
+
+	sm := crawl.StartContext(ctx)
+	if ctx.Err() != nil {
+		logger.Println("crawl interrupted, printing partial sitemap")
+	}
+
+	if cache != nil {
+		if err := cache.Save(); err != nil {
+			log.Println("error saving link cache", err)
+		}
 	}
-	fmt.Println(string(data))
 
-	if *stdXMLSiteMap {
-		xsm, err := sm.ToXMLSTDSiteMap()
+	if checkMode {
+		broken, fragments := sm.BrokenLinks(), sm.BrokenFragments()
+		writeReport(os.Stdout, broken, fragments)
+		if len(broken)+len(fragments) > *threshold {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if prev != nil {
+		sm.Compare(prev)
+	}
+	sm.Summarize()
+	if graph != "json" {
+		err := sm.Export(os.Stdout, graph,
+			&sitemap.ExportConfig{ClusterDepth: *clusterDepth})
+		if err != nil {
+			log.Println("error exporting graph", err)
+		}
+	} else {
+		data, err := json.MarshalIndent(sm, "  ", "    ")
+		if err != nil {
+			log.Println("error marshaling data to json", err)
+		}
+		fmt.Println(string(data))
+	}
+
+	if *outDir != "" {
+		base := *baseURL
+		if base == "" {
+			base = (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+		}
+		files, err := sm.WriteFiles(&sitemap.IndexConfig{
+			Dir:            *outDir,
+			BaseURL:        base,
+			Gzip:           *gz,
+			GroupBySection: *group,
+			XML:            xc,
+		})
+		if err != nil {
+			log.Fatalln("error writing sitemap files", err)
+		}
+		logger.Printf("wrote %d sitemap files in %s", len(files), *outDir)
+	} else if *stdXMLSiteMap && graph == "json" {
+		xsm, err := sm.ToXMLSTDSiteMapConfig(xc)
 		if err != nil {
 			log.Println("error marshaling data to xml", err)
 		}
 		fmt.Println("StdSiteMap:\n", string(xsm))
 	}
 }
+
+// loadSiteMap reads the json output of a crawl from file
+func loadSiteMap(file string) (*sitemap.SiteMap, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return sitemap.Load(f)
+}
+
+// readSeeds gives the urls to crawl from, the ones of list and file
+// or else domain, scheme is used for urls which have none
+func readSeeds(domain, list, file, scheme string) ([]*url.URL, error) {
+	var raws []string
+	if list != "" {
+		raws = strings.Split(list, ",")
+	}
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		raws = append(raws, strings.Split(string(data), "\n")...)
+	}
+	if len(raws) == 0 {
+		raws = []string{domain}
+	}
+
+	var seeds []*url.URL
+	for _, raw := range raws {
+		raw = strings.TrimSpace(raw)
+		if raw == "" || strings.HasPrefix(raw, "#") {
+			continue
+		}
+		if !strings.Contains(raw, "://") {
+			raw = scheme + "://" + raw
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("seed %q has no host", raw)
+		}
+		seeds = append(seeds, u)
+	}
+	if len(seeds) == 0 {
+		return nil, fmt.Errorf("no url to crawl")
+	}
+	return seeds, nil
+}
+
+// newScope builds the crawl scope selected from command line,
+// it covers the hosts of all seeds
+func newScope(name string, seeds []*url.URL, hosts, prefix string,
+	root bool) (scope.Scope, error) {
+	var seedHosts []string
+	for _, u := range seeds {
+		seedHosts = append(seedHosts, u.Host)
+	}
+	each := func(f func(string) scope.Scope) scope.Scope {
+		var scopes []scope.Scope
+		for _, h := range seedHosts {
+			scopes = append(scopes, f(h))
+		}
+		return scope.OneOf(scopes...)
+	}
+
+	var sc scope.Scope
+	switch {
+	case !root:
+		sc = scope.Any()
+	case name == "host":
+		sc = scope.Hosts(seedHosts...)
+	case name == "subdomains":
+		sc = each(scope.Subdomains)
+	case name == "domain":
+		sc = each(scope.Domain)
+	case name == "hosts":
+		if hosts == "" {
+			return nil, fmt.Errorf("-scope=hosts needs -hosts")
+		}
+		sc = scope.Hosts(append(strings.Split(hosts, ","), seedHosts...)...)
+	default:
+		return nil, fmt.Errorf("unknown scope %q", name)
+	}
+
+	if prefix != "" {
+		sc = scope.All(sc, scope.PathPrefix(prefix))
+	}
+	return sc, nil
+}
+
+// newXMLConfig reads the rules of the standard sitemap given
+// from command line
+func newXMLConfig(changeFreqs, priorities []string,
+	depthPriority bool) (*sitemap.XMLConfig, error) {
+	xc := &sitemap.XMLConfig{DepthPriority: depthPriority}
+	for _, v := range changeFreqs {
+		r, err := sitemap.ParseFreqRule(v)
+		if err != nil {
+			return nil, err
+		}
+		xc.ChangeFreq = append(xc.ChangeFreq, r)
+	}
+	for _, v := range priorities {
+		r, err := sitemap.ParsePriorityRule(v)
+		if err != nil {
+			return nil, err
+		}
+		xc.Priority = append(xc.Priority, r)
+	}
+	return xc, nil
+}
+
+// stringList is a flag which can be given multiple times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// userAgentTransport sets the User-Agent header on every request
+type userAgentTransport struct {
+	agent string
+	rt    http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(r *http.Request) (*http.Response,
+	error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("User-Agent", t.agent)
+	return t.rt.RoundTrip(r)
+}
@@ -1,6 +1,9 @@
 module github.com/khrm/smap
 
+go 1.16
+
 require (
 	github.com/fortytw2/leaktest v1.2.0
 	golang.org/x/net v0.0.0-20180807145015-19491d39cadb
+	golang.org/x/text v0.3.0 // indirect
 )
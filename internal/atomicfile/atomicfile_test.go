@@ -0,0 +1,43 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "state", "links.json")
+
+	for _, data := range []string{`{"a":1}`, `{}`} {
+		if err := WriteFile(name, []byte(data)); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		got, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("WriteFile() wrote %q, want %q", got, data)
+		}
+	}
+	files, err := ioutil.ReadDir(filepath.Dir(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("WriteFile() left %d files, want 1", len(files))
+	}
+}
+
+func TestWriteFileError(t *testing.T) {
+	dir := t.TempDir()
+	// A file stands where the directory should be
+	if err := WriteFile(filepath.Join(dir, "f"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(filepath.Join(dir, "f", "g"), nil); err == nil {
+		t.Error("WriteFile() error = nil, want an error")
+	}
+}
@@ -0,0 +1,93 @@
+// Package checkpoint saves the state of a crawl in a directory
+// so that it can be resumed after a crash
+package checkpoint
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/khrm/smap/internal/atomicfile"
+	"github.com/khrm/smap/internal/sitemap"
+)
+
+// stateFile is the name of the file holding the state in the directory
+const stateFile = "state.json"
+
+// Phases of a crawl
+const (
+	// PhaseSeeds is the crawl from the root and the seeds
+	PhaseSeeds = iota
+	// PhaseSitemaps is the crawl from the urls only found in sitemaps
+	PhaseSitemaps
+)
+
+// State is what is needed to resume a crawl
+type State struct {
+	Phase int
+	// Depth is the level being crawled in the phase, Frontier are
+	// the urls of the level left to fetch and Next the urls of the
+	// next level found so far
+	Depth    int
+	Frontier []string
+	Next     []string `json:",omitempty"`
+	// SiteMap holds the urls visited and the graph
+	SiteMap *sitemap.SiteMap
+}
+
+// Store saves and loads the state of a crawl in a directory
+type Store struct {
+	dir string
+}
+
+// New gives a Store keeping its files in dir
+func New(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Save writes st, replacing the previous state only once
+// it's fully written so that a crash leaves one of them whole
+// The sitemap is locked while it's encoded
+func (s *Store) Save(st *State) error {
+	st.SiteMap.Lock()
+	data, err := json.Marshal(st)
+	st.SiteMap.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(filepath.Join(s.dir, stateFile), data)
+}
+
+// Load reads the last state saved
+// The error satisfies errors.Is(err, os.ErrNotExist) if there's none
+func (s *Store) Load() (*State, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, stateFile))
+	if err != nil {
+		return nil, err
+	}
+	st := &State{}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, err
+	}
+	if st.SiteMap == nil {
+		st.SiteMap = sitemap.New()
+	}
+	if st.SiteMap.URLs == nil {
+		st.SiteMap.URLs = make(map[string]*sitemap.Node)
+	}
+	if st.SiteMap.Connections == nil {
+		st.SiteMap.Connections = make(map[string]map[string]sitemap.Edge)
+	}
+	return st, nil
+}
+
+// Remove deletes the state saved, i.e. once the crawl is over
+func (s *Store) Remove() error {
+	err := os.Remove(filepath.Join(s.dir, stateFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package checkpoint
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/khrm/smap/internal/parser"
+	"github.com/khrm/smap/internal/sitemap"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s := New(dir)
+
+	if _, err := s.Load(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Store.Load() without state = %v, want %v", err,
+			os.ErrNotExist)
+	}
+
+	sm := sitemap.New()
+	sm.AddURL("https://ex.io", 0)
+	sm.AddURL("https://ex.io/a", 1)
+	sm.SetFetch("https://ex.io", &parser.Fetch{Status: 200,
+		ResponseTime: parser.Duration(150 * time.Millisecond)})
+	sm.AddConnection("https://ex.io", "https://ex.io/a")
+	sm.AddSkipped("https://ex.io/admin", "blocked by robots")
+	want := &State{
+		Phase:    PhaseSitemaps,
+		Depth:    1,
+		Frontier: []string{"https://ex.io/a"},
+		SiteMap:  sm,
+	}
+	if err := s.Save(want); err != nil {
+		t.Fatal(err)
+	}
+	want.Frontier = []string{"https://ex.io/b"}
+	if err := s.Save(want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Store.Load() = %+v, want %+v", got, want)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != stateFile {
+		t.Errorf("files left in %s: %d, want only %s", dir, len(files),
+			stateFile)
+	}
+
+	if err := s.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove(); err != nil {
+		t.Errorf("Store.Remove() without state = %v", err)
+	}
+	if _, err := s.Load(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Store.Load() after Remove = %v, want %v", err,
+			os.ErrNotExist)
+	}
+}
@@ -0,0 +1,110 @@
+package crawler
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/khrm/smap/internal/checkpoint"
+)
+
+// defaultBatch is the number of urls fetched between two checkpoints
+const defaultBatch = 100
+
+// WithCheckpoint makes the crawler save its state in st, at most once
+// every interval, so that the crawl can be resumed with WithResume
+// The state is removed once the crawl is over
+func (c *CondConfig) WithCheckpoint(st *checkpoint.Store,
+	every time.Duration) *CondConfig {
+	c.store = st
+	c.every = every
+	c.batch = defaultBatch
+	return c
+}
+
+// WithResume makes the crawler continue the crawl whose state is st
+// instead of starting from the root and the seeds
+func (c *CondConfig) WithResume(st *checkpoint.State) *CondConfig {
+	c.resume = st
+	return c
+}
+
+// resume restores the sitemap and the phase of st and gives
+// the level to crawl next
+func (s *Service) resume(st *checkpoint.State) (frontier,
+	next []*url.URL, depth int) {
+	s.sm = st.SiteMap
+	s.phase = st.Phase
+	frontier, next = s.parseAll(st.Frontier), s.parseAll(st.Next)
+	if len(frontier) == 0 {
+		return next, nil, st.Depth + 1
+	}
+	return frontier, next, st.Depth
+}
+
+// parseAll parses urls saved in a state, invalid ones are dropped
+func (s *Service) parseAll(urls []string) []*url.URL {
+	var parsed []*url.URL
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			continue
+		}
+		parsed = append(parsed, u)
+	}
+	return parsed
+}
+
+// checkpoint saves the state if the interval since the last
+// checkpoint is elapsed
+func (s *Service) checkpoint(depth int, frontier, next []*url.URL) {
+	if s.c.store == nil || time.Since(s.saved) < s.c.every {
+		return
+	}
+	s.save(depth, frontier, next)
+}
+
+// save saves the state of the crawl, the frontier at depth along
+// with next level found so far
+func (s *Service) save(depth int, frontier, next []*url.URL) {
+	if s.c.store == nil {
+		return
+	}
+	st := &checkpoint.State{
+		Phase:    s.phase,
+		Depth:    depth,
+		Frontier: urlStrings(frontier),
+		Next:     urlStrings(next),
+		SiteMap:  s.sm,
+	}
+	if err := s.c.store.Save(st); err != nil {
+		s.log.Println("error saving checkpoint", err)
+		return
+	}
+	s.saved = time.Now()
+	if s.c.debug {
+		s.log.Printf("checkpoint saved at depth %d, %d urls left", depth,
+			len(frontier))
+	}
+}
+
+// finish removes the state once the crawl is over
+func (s *Service) finish() {
+	if s.c.store == nil {
+		return
+	}
+	if err := s.c.store.Remove(); err != nil {
+		s.log.Println("error removing checkpoint", err)
+	}
+}
+
+// urlStrings gives the string form of urls
+func urlStrings(urls []*url.URL) []string {
+	if len(urls) == 0 {
+		return nil
+	}
+	s := make([]string, len(urls))
+	for i, u := range urls {
+		s[i] = u.String()
+	}
+	return s
+}
@@ -1,20 +1,32 @@
 package crawler
 
 import (
+	"context"
 	"errors"
 	"log"
 	"net/url"
-	"strings"
 	"sync"
+	"time"
 
+	"github.com/khrm/smap/internal/checkpoint"
+	"github.com/khrm/smap/internal/linkcheck"
+	"github.com/khrm/smap/internal/normalize"
 	"github.com/khrm/smap/internal/parser"
+	"github.com/khrm/smap/internal/retry"
+	"github.com/khrm/smap/internal/robots"
+	"github.com/khrm/smap/internal/scope"
+	"github.com/khrm/smap/internal/seed"
 	"github.com/khrm/smap/internal/sitemap"
+	"github.com/khrm/smap/internal/throttle"
 )
 
 var (
 	errInvalidURL = errors.New("link isn't valid")
 )
 
+// reasonRobots is recorded in sitemap for urls disallowed by robots.txt
+const reasonRobots = "blocked by robots"
+
 // CondConfig is used to determine certain conditional
 // configs like whether only root url are going to be
 // extracted or depth of the query
@@ -22,8 +34,37 @@ type CondConfig struct {
 	rootOnly bool
 	depth    *int
 	debug    bool
+	robots   *robots.Cache
+	workers  uint
+	scope    scope.Scope
+	filter   *scope.Filter
+	follow   map[string]struct{}
+	norm     *normalize.Normalizer
+	maxChain int
+	nofollow bool
+	loader   *seed.Loader
+	sitemaps []string
+	seeds    []*url.URL
+	retry    *retry.Policy
+	store    *checkpoint.Store
+	every    time.Duration
+	batch    int
+	resume   *checkpoint.State
+	prev     *sitemap.SiteMap
+	checker  *linkcheck.Checker
+	checkers uint
+	throttle *throttle.Client
 }
 
+// DefaultFollow are the elements whose links are crawled by default,
+// links of other elements are recorded as resources of the page
+// Hreflang alternates are always crawled so that they can be checked
+var DefaultFollow = []string{"a", "area", "frame", "iframe", "meta"}
+
+// defaultWorkers is the number of urls of a host fetched in parallel
+// when it isn't configured
+const defaultWorkers = 3
+
 // NewConfig gives an instance of config
 func NewConfig(r bool, d *int, debug bool) *CondConfig {
 	return &CondConfig{
@@ -33,6 +74,117 @@ func NewConfig(r bool, d *int, debug bool) *CondConfig {
 	}
 }
 
+// WithRobots makes the crawler respect robots.txt of every host
+// through r, nil means robots.txt is ignored
+func (c *CondConfig) WithRobots(r *robots.Cache) *CondConfig {
+	c.robots = r
+	return c
+}
+
+// WithScope sets the policy deciding which urls are crawled
+// Without it, only urls of root host are crawled if rootOnly is set
+// and every url is crawled otherwise
+func (c *CondConfig) WithScope(sc scope.Scope) *CondConfig {
+	c.scope = sc
+	return c
+}
+
+// WithFilter sets include and exclude patterns for urls found
+// while crawling, root url is always crawled
+func (c *CondConfig) WithFilter(f *scope.Filter) *CondConfig {
+	c.filter = f
+	return c
+}
+
+// WithFollow sets the elements whose links are crawled
+// i.e. a, iframe, links of other elements are recorded as resources
+func (c *CondConfig) WithFollow(tags ...string) *CondConfig {
+	c.follow = make(map[string]struct{}, len(tags))
+	for _, t := range tags {
+		c.follow[t] = struct{}{}
+	}
+	return c
+}
+
+// follows tells whether link l is crawled
+func (c *CondConfig) follows(l parser.Link) bool {
+	if l.Hreflang != "" {
+		return true
+	}
+	if c.follow == nil {
+		for _, t := range DefaultFollow {
+			if t == l.Tag {
+				return true
+			}
+		}
+		return false
+	}
+	_, ok := c.follow[l.Tag]
+	return ok
+}
+
+// WithNormalizer sets the rules giving the canonical form of urls
+// Without it normalize.Default is used
+func (c *CondConfig) WithNormalizer(n *normalize.Normalizer) *CondConfig {
+	c.norm = n
+	return c
+}
+
+// WithMaxRedirectChain sets the number of redirections after which
+// a redirect chain is reported as an issue of the url, 0 disables it
+func (c *CondConfig) WithMaxRedirectChain(n int) *CondConfig {
+	c.maxChain = n
+	return c
+}
+
+// WithNofollow makes the crawler respect nofollow, links of pages
+// with a nofollow robots directive and rel="nofollow" links aren't
+// crawled
+func (c *CondConfig) WithNofollow(respect bool) *CondConfig {
+	c.nofollow = respect
+	return c
+}
+
+// WithSitemapSeeds makes the crawler read sitemaps once the root is
+// crawled, urls listed in them which weren't found are crawled in turn
+// and marked as orphans
+// Sitemaps read are the ones given along with the ones announced in
+// robots.txt, or else /sitemap.xml of the root and of the seeds
+func (c *CondConfig) WithSitemapSeeds(l *seed.Loader,
+	sitemaps ...string) *CondConfig {
+	c.loader = l
+	c.sitemaps = sitemaps
+	return c
+}
+
+// WithSeeds adds urls which are crawled from depth 0 along with
+// the root, the default scope covers all their hosts
+func (c *CondConfig) WithSeeds(seeds ...*url.URL) *CondConfig {
+	c.seeds = append(c.seeds, seeds...)
+	return c
+}
+
+// WithRetry makes the crawler retry urls failing with a transient
+// error or status as told by p, nil means they aren't retried
+func (c *CondConfig) WithRetry(p *retry.Policy) *CondConfig {
+	c.retry = p
+	return c
+}
+
+// WithWorkers sets the number of urls of a host fetched in parallel,
+// the parser limits requests in flight over all hosts
+func (c *CondConfig) WithWorkers(n uint) *CondConfig {
+	c.workers = n
+	return c
+}
+
+func (c *CondConfig) nbrWorkers() int {
+	if c.workers == 0 {
+		return defaultWorkers
+	}
+	return int(c.workers)
+}
+
 // Service contains detail needed for crawler Service
 type Service struct {
 	root   *url.URL
@@ -40,6 +192,12 @@ type Service struct {
 	log    *log.Logger
 	sm     *sitemap.SiteMap
 	c      *CondConfig
+	scope  scope.Scope
+	norm   *normalize.Normalizer
+	// phase is the crawl in progress and saved the time of
+	// the last checkpoint
+	phase int
+	saved time.Time
 }
 
 // New gives an instance of crawler.service needed to crawl documents
@@ -58,89 +216,371 @@ func New(r *url.URL, p parser.ServiceParse, l *log.Logger,
 // Start the crawl service and save them the links find
 // in the sitemap graph
 func (s *Service) Start() (sm *sitemap.SiteMap) {
+	return s.StartContext(context.Background())
+}
+
+// StartContext is like Start but stops crawling once ctx is cancelled
+// It waits for requests in flight to abort and returns
+// the sitemap collected so far
+// Urls are crawled level by level, so every url is added
+// at its shortest click depth from the root
+func (s *Service) StartContext(ctx context.Context) (sm *sitemap.SiteMap) {
 	if s.c == nil {
 		s.log.Println("config passed is nil")
 		return nil
 	}
 
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	s.crawl(s.root, s.c, wg)
-	wg.Wait()
+	s.norm = s.c.norm
+	if s.norm == nil {
+		s.norm = normalize.Default()
+	}
+	s.root = s.norm.Normalize(s.root)
+	seeds := []*url.URL{s.root}
+	for _, u := range s.c.seeds {
+		seeds = append(seeds, s.norm.Normalize(u))
+	}
+
+	s.scope = s.c.scope
+	if s.scope == nil && s.c.rootOnly {
+		s.scope = scope.Hosts(hosts(seeds)...)
+	} else if s.scope == nil {
+		s.scope = scope.Any()
+	}
+
+	s.phase = checkpoint.PhaseSeeds
+	s.saved = time.Now()
+	var frontier, next []*url.URL
+	depth := 0
+	if s.c.resume != nil {
+		frontier, next, depth = s.resume(s.c.resume)
+	} else {
+		for _, u := range seeds {
+			if s.allowed(ctx, u) && s.sm.AddURL(u.String(), 0) {
+				frontier = append(frontier, u)
+			}
+		}
+	}
+
+	if s.phase == checkpoint.PhaseSeeds {
+		s.crawl(ctx, frontier, next, depth)
+		frontier, next, depth = nil, nil, 0
+		if s.c.loader != nil && ctx.Err() == nil {
+			frontier = s.sitemapSeeds(ctx)
+			s.phase = checkpoint.PhaseSitemaps
+			if ctx.Err() == nil {
+				s.save(depth, frontier, nil)
+			}
+		}
+	}
+	if s.phase == checkpoint.PhaseSitemaps {
+		s.crawl(ctx, frontier, next, depth)
+	}
+	s.sm.CheckAlternates()
+	if ctx.Err() == nil {
+		s.checkExternal(ctx)
+	}
+	if ctx.Err() == nil {
+		s.finish()
+	}
 	return s.sm
 }
 
-// crawl service get the urls and determine their links
-// it save them in sitemap graph
-func (s *Service) crawl(u *url.URL, c *CondConfig, wg *sync.WaitGroup) {
-	defer wg.Done()
-	//current link
-	clink := u.String()
-	ok := s.sm.AddURL(clink)
-	if !ok {
-		return
+// hosts gives the hosts of urls in order, without duplicates
+func hosts(urls []*url.URL) []string {
+	var hosts []string
+	seen := map[string]struct{}{}
+	for _, u := range urls {
+		if _, ok := seen[u.Host]; !ok {
+			seen[u.Host] = struct{}{}
+			hosts = append(hosts, u.Host)
+		}
 	}
+	return hosts
+}
 
-	var depth *int
+// crawl crawls level by level from the urls of frontier which
+// are at depth, next are the urls of the next level already found
+func (s *Service) crawl(ctx context.Context, frontier, next []*url.URL,
+	depth int) {
+	for ; len(frontier) > 0; depth++ {
+		if s.c.depth != nil && depth >= *s.c.depth {
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		frontier, next = s.crawlLevel(ctx, frontier, next, depth), nil
+	}
+}
 
-	if c.depth != nil && *c.depth == 0 {
-		return
-	} else if c.depth == nil {
-		depth = nil
-	} else {
-		d := *c.depth - 1
-		depth = &d
+// crawlLevel fetches all urls of the frontier found at depth and
+// saves their links in sitemap graph
+// Urls are fetched in batches when checkpoints are taken, the state
+// is saved between them
+// It returns next along with the urls newly found which make up
+// the next level
+func (s *Service) crawlLevel(ctx context.Context, frontier,
+	next []*url.URL, depth int) []*url.URL {
+	size := len(frontier)
+	if s.c.store != nil && s.c.batch < size {
+		size = s.c.batch
+	}
+	for len(frontier) > 0 {
+		if size > len(frontier) {
+			size = len(frontier)
+		}
+		next = s.crawlBatch(ctx, frontier[:size], next, depth)
+		frontier = frontier[size:]
+		if ctx.Err() != nil {
+			return next
+		}
+		s.checkpoint(depth, frontier, next)
 	}
+	return next
+}
 
-	urls, err := s.parser.ExtractURLs(clink)
-	if err != nil {
-		if s.c.debug {
-			s.log.Println("Crawler encountered an error", err,
-				"while crawling", clink)
+// crawlBatch fetches urls of the frontier found at depth and saves
+// their links in sitemap graph
+// It returns next along with the urls newly found
+func (s *Service) crawlBatch(ctx context.Context, frontier,
+	next []*url.URL, depth int) []*url.URL {
+	results := make([]*parser.Page, len(frontier))
+
+	// Every host has its own workers, a host held back by the client
+	// only holds its urls back, the parser limits requests in flight
+	var hosts []string
+	jobs := make(map[string]chan int)
+	for i, u := range frontier {
+		if _, ok := jobs[u.Host]; !ok {
+			hosts = append(hosts, u.Host)
+			jobs[u.Host] = make(chan int, len(frontier))
 		}
+		jobs[u.Host] <- i
 	}
+	wg := &sync.WaitGroup{}
+	for _, h := range hosts {
+		close(jobs[h])
+		n := s.c.nbrWorkers()
+		if len(jobs[h]) < n {
+			n = len(jobs[h])
+		}
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(jobs chan int) {
+				defer wg.Done()
+				for j := range jobs {
+					results[j] = s.fetch(ctx, frontier[j])
+				}
+			}(jobs[h])
+		}
+	}
+	wg.Wait()
 
-	for i := range urls {
-		l, err := s.urlParse(u, urls[i])
-		if err != nil {
+	// Links are processed in frontier order, so next level is the
+	// same between runs
+	for i, u := range frontier {
+		if results[i] == nil {
 			continue
 		}
-		link := l.String()
-		if c.rootOnly && strings.Contains(link, s.root.Host) {
-			cond := *c
-			// add the reduced depth
-			cond.depth = depth
-			wg.Add(1)
-			go s.crawl(l, &cond, wg)
-			s.sm.AddConnection(clink, link)
+		doc := documentURL(u, &results[i].Fetch)
+		// Links belong to the url where the redirections ended
+		u, ok := s.followRedirects(ctx, u, &results[i].Fetch,
+			depth)
+		if !ok {
+			continue
+		}
+		clink := u.String()
+		if m := results[i].Modified; m != "" {
+			s.sm.UpdateNode(clink, func(n *sitemap.Node) {
+				n.Modified = m
+			})
+		}
+		if t := results[i].Title; t != "" {
+			s.sm.UpdateNode(clink, func(n *sitemap.Node) {
+				n.Title = t
+			})
+		}
+		base := s.baseURL(doc, results[i].Base)
+		s.setMedia(clink, base, results[i])
+		s.setDirectives(clink, base, results[i])
+		s.setAnchors(clink, results[i])
+		for _, pl := range results[i].Links {
+			if ctx.Err() != nil {
+				return next
+			}
+			l, err := s.urlParse(base, pl.URL)
+			if err != nil {
+				continue
+			}
+			if pl.Hreflang != "" {
+				s.sm.AddAlternate(clink, pl.Hreflang, l.String())
+			}
+			if !s.c.follows(pl) {
+				if scope.Any().InScope(l) {
+					s.sm.AddResource(clink, l.String())
+				}
+				continue
+			}
+			if s.nofollowed(results[i], pl) {
+				continue
+			}
+			if !s.scope.InScope(l) {
+				s.external(clink, l, pl)
+				continue
+			}
+			link := l.String()
+			if !s.filtered(l) || !s.allowed(ctx, l) {
+				s.skippedLink(clink, link)
+				continue
+			}
+			if s.sm.AddURL(link, depth+1) {
+				next = append(next, l)
+			}
+			if pl.Hreflang != "" {
+				s.sm.AddEdge(clink, link,
+					sitemap.Edge{Type: sitemap.EdgeAlternate})
+				continue
+			}
+			s.sm.AddEdge(clink, link, sitemap.Edge{Text: pl.Text,
+				Fragments: fragments(pl)})
 		}
 	}
+	return next
 }
 
-func (s *Service) urlParse(r *url.URL, path string) (*url.URL, error) {
-	l, err := url.Parse(path)
-	if err != nil {
+// fetch gets the links present in document of u
+func (s *Service) fetch(ctx context.Context, u *url.URL) *parser.Page {
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	s.crawlDelay(ctx, u)
+	o := parser.Options{
+		Allow:      s.redirectAllowed(ctx),
+		Validators: s.validators(u),
+	}
+	for attempt := 1; ; attempt++ {
+		page, err := s.parser.ExtractURLs(ctx, u.String(), o)
+		if err != nil && s.c.debug {
+			s.log.Println("Crawler encountered an error", err,
+				"while crawling", u)
+		}
+		if ctx.Err() != nil {
+			return page
+		}
+
+		status := 0
+		if page != nil {
+			status = page.Fetch.Status
+		}
+		if page != nil && err != nil {
+			// The response came, err only tells it isn't usable html
+			err = nil
+		}
+		if !s.c.retry.Retry(attempt, status, err) {
+			s.failed(u, attempt, page, err)
+			return s.reuse(u, page)
+		}
+
+		d := s.c.retry.Backoff(attempt)
 		if s.c.debug {
-			s.log.Println("link:", path, " isn't valid, err",
-				err)
+			s.log.Println("retrying", u, "in", d)
 		}
-		return nil, errInvalidURL
+		if retry.Sleep(ctx, d) != nil {
+			return page
+		}
+	}
+}
+
+// failed records on the node of u the number of attempts made to
+// fetch it and, if no response was got, the reason why
+func (s *Service) failed(u *url.URL, attempts int, page *parser.Page,
+	err error) {
+	if attempts == 1 && (page != nil || err == nil) {
+		return
 	}
+	s.sm.UpdateNode(u.String(), func(n *sitemap.Node) {
+		if attempts > 1 {
+			n.Attempts = attempts
+		}
+		if page == nil && err != nil {
+			n.Error = err.Error()
+		}
+	})
+}
 
-	// If scheme isn't there we put current link scheme
-	if l.Scheme == "" {
-		l.Scheme = r.Scheme
+// skippedLink records on the node of page that its link to u
+// wasn't crawled, so that the link is found again if the page is
+// reused by the next crawl
+func (s *Service) skippedLink(page, u string) {
+	s.sm.UpdateNode(page, func(n *sitemap.Node) {
+		for _, l := range n.SkippedLinks {
+			if l == u {
+				return
+			}
+		}
+		n.SkippedLinks = append(n.SkippedLinks, u)
+	})
+}
+
+// filtered checks include and exclude patterns for u and records
+// it as skipped in the sitemap if it doesn't pass them
+func (s *Service) filtered(u *url.URL) bool {
+	if s.c.filter == nil {
+		return true
+	}
+	ok, reason := s.c.filter.Check(u)
+	if !ok {
+		s.sm.AddSkipped(u.String(), reason)
 	}
+	return ok
+}
 
-	// if host isn't there, we put current url's host
-	if l.Host == "" {
-		l.Host = r.Host
+// allowed checks robots.txt for u and records it as skipped
+// in the sitemap if it's disallowed
+func (s *Service) allowed(ctx context.Context, u *url.URL) bool {
+	if s.c.robots == nil {
+		return true
+	}
+	for _, sm := range s.c.robots.Get(ctx, u).Sitemaps {
+		s.sm.AddSitemap(sm)
+	}
+	if s.c.robots.Allowed(ctx, u) {
+		return true
 	}
+	if s.c.debug {
+		s.log.Println("link:", u, "is disallowed by robots.txt")
+	}
+	s.sm.AddSkipped(u.String(), reasonRobots)
+	return false
+}
 
-	// Fragment means they are same url
-	l.Fragment = ""
+// baseURL gives the url against which links of document u are
+// resolved, it's the document base href if any
+func (s *Service) baseURL(u *url.URL, href string) *url.URL {
+	if href == "" {
+		return u
+	}
+	b, err := url.Parse(href)
+	if err != nil {
+		if s.c.debug {
+			s.log.Println("base:", href, "of", u, "isn't valid, err", err)
+		}
+		return u
+	}
+	return u.ResolveReference(b)
+}
 
-	// We remove trailing / as url with and without it are same
-	l.Path = strings.TrimRight(l.Path, "/")
-	return l, nil
+// urlParse resolves path against base url as per RFC 3986
+// and gives its canonical form
+func (s *Service) urlParse(base *url.URL, path string) (*url.URL, error) {
+	l, err := url.Parse(path)
+	if err != nil {
+		if s.c.debug {
+			s.log.Println("link:", path, " isn't valid, err",
+				err)
+		}
+		return nil, errInvalidURL
+	}
+	return s.norm.Normalize(base.ResolveReference(l)), nil
 }
@@ -1,16 +1,32 @@
 package crawler
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"net/url"
+	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/fortytw2/leaktest"
+	"github.com/khrm/smap/internal/checkpoint"
+	"github.com/khrm/smap/internal/linkcheck"
+	"github.com/khrm/smap/internal/normalize"
 	"github.com/khrm/smap/internal/parser"
+	"github.com/khrm/smap/internal/redirect"
+	"github.com/khrm/smap/internal/retry"
+	"github.com/khrm/smap/internal/robots"
+	"github.com/khrm/smap/internal/scope"
+	"github.com/khrm/smap/internal/seed"
 	"github.com/khrm/smap/internal/sitemap"
+	"github.com/khrm/smap/internal/throttle"
 )
 
 // TestNewConfig test function NewConfig
@@ -47,42 +63,57 @@ func TestNewConfig(t *testing.T) {
 
 type mockParser struct{}
 
-func (m *mockParser) ExtractURLs(url string) ([]string, error) {
+// anchors gives urls as links found in a elements
+func anchors(urls ...string) []parser.Link {
+	links := make([]parser.Link, len(urls))
+	for i, u := range urls {
+		links[i] = parser.Link{URL: u, Tag: "a", Attr: "href"}
+	}
+	return links
+}
+
+// page gives a page made of urls found in a elements
+func page(urls ...string) *parser.Page {
+	return &parser.Page{Links: anchors(urls...)}
+}
+
+func (m *mockParser) ExtractURLs(ctx context.Context, url string,
+	o parser.Options) (*parser.Page, error) {
 	switch url {
 	case "https://goharbor.io":
-		return []string{"https://goharbor.io",
+		return page("https://goharbor.io",
 			"/blogs",
 			"https://goharbor.io/community",
 			"https://goharbor.io/docs",
-			"://wrongUrl"}, nil
+			"://wrongUrl"), nil
 	case "https://goharbor.io/blogs":
-		return []string{"https://goharbor.io",
+		return page("https://goharbor.io",
 			"https://goharbor.io/blogs",
 			"https://goharbor.io/blogs/harbor-joins-cncf",
 			"https://goharbor.io/blogs/hello-world",
 			"https://goharbor.io/community",
-			"https://goharbor.io/docs"}, nil
+			"https://goharbor.io/docs"), nil
 	case "https://goharbor.io/blogs/harbor-joins-cncf":
-		return []string{"https://goharbor.io",
+		return page("https://goharbor.io",
 			"https://goharbor.io/blogs",
 			"https://goharbor.io/community",
-			"https://goharbor.io/docs"}, nil
+			"https://goharbor.io/docs"), nil
 	case "https://goharbor.io/blogs/hello-world":
-		return []string{"https://goharbor.io",
+		return page("https://goharbor.io",
 			"https://goharbor.io/blogs",
 			"https://goharbor.io/community",
 			"https://nonrooturl/won'tgetadded",
-			"https://goharbor.io/docs"}, nil
+			"https://goharbor.io/docs"), nil
 	case "https://goharbor.io/community":
-		return []string{"https://goharbor.io",
+		return page("https://goharbor.io",
 			"https://goharbor.io/blogs",
 			"https://goharbor.io/community",
-			"https://goharbor.io/docs"}, nil
+			"https://goharbor.io/docs"), nil
 	case "https://goharbor.io/docs":
-		return []string{"https://goharbor.io",
+		return page("https://goharbor.io",
 			"https://goharbor.io/blogs",
 			"https://goharbor.io/community",
-			"https://goharbor.io/docs"}, nil
+			"https://goharbor.io/docs"), nil
 	default:
 		return nil, errors.New("crawling failed")
 	}
@@ -174,52 +205,54 @@ func Test_service_Start(t *testing.T) {
 	}
 
 	want1 := &sitemap.SiteMap{
-		URLs: map[string]struct{}{
-			"https://goharbor.io":                         {},
-			"https://goharbor.io/blogs":                   {},
-			"https://goharbor.io/blogs/harbor-joins-cncf": {},
-			"https://goharbor.io/blogs/hello-world":       {},
-			"https://goharbor.io/community":               {},
-			"https://goharbor.io/docs":                    {},
+		URLs: map[string]*sitemap.Node{
+			"https://goharbor.io":                         {Depth: 0, Fetch: &parser.Fetch{}},
+			"https://goharbor.io/blogs":                   {Depth: 1, Fetch: &parser.Fetch{}},
+			"https://goharbor.io/blogs/harbor-joins-cncf": {Depth: 2, Fetch: &parser.Fetch{}},
+			"https://goharbor.io/blogs/hello-world":       {Depth: 2, Fetch: &parser.Fetch{}},
+			"https://goharbor.io/community":               {Depth: 1, Fetch: &parser.Fetch{}},
+			"https://goharbor.io/docs":                    {Depth: 1, Fetch: &parser.Fetch{}},
 		},
-		Connections: map[string]map[string]struct{}{
+		Connections: map[string]map[string]sitemap.Edge{
 			"https://goharbor.io": {
-				"https://goharbor.io":           struct{}{},
-				"https://goharbor.io/blogs":     struct{}{},
-				"https://goharbor.io/community": struct{}{},
-				"https://goharbor.io/docs":      struct{}{},
+				"https://goharbor.io":           {},
+				"https://goharbor.io/blogs":     {},
+				"https://goharbor.io/community": {},
+				"https://goharbor.io/docs":      {},
 			},
 			"https://goharbor.io/blogs": {
-				"https://goharbor.io":                         struct{}{},
-				"https://goharbor.io/blogs":                   struct{}{},
-				"https://goharbor.io/blogs/harbor-joins-cncf": struct{}{},
-				"https://goharbor.io/blogs/hello-world":       struct{}{},
-				"https://goharbor.io/community":               struct{}{},
-				"https://goharbor.io/docs":                    struct{}{},
+				"https://goharbor.io":                         {},
+				"https://goharbor.io/blogs":                   {},
+				"https://goharbor.io/blogs/harbor-joins-cncf": {},
+				"https://goharbor.io/blogs/hello-world":       {},
+				"https://goharbor.io/community":               {},
+				"https://goharbor.io/docs":                    {},
 			},
 			"https://goharbor.io/blogs/harbor-joins-cncf": {
-				"https://goharbor.io":           struct{}{},
-				"https://goharbor.io/blogs":     struct{}{},
-				"https://goharbor.io/community": struct{}{},
-				"https://goharbor.io/docs":      struct{}{},
+				"https://goharbor.io":           {},
+				"https://goharbor.io/blogs":     {},
+				"https://goharbor.io/community": {},
+				"https://goharbor.io/docs":      {},
 			},
 			"https://goharbor.io/blogs/hello-world": {
-				"https://goharbor.io":           struct{}{},
-				"https://goharbor.io/blogs":     struct{}{},
-				"https://goharbor.io/community": struct{}{},
-				"https://goharbor.io/docs":      struct{}{},
+				"https://goharbor.io":           {},
+				"https://goharbor.io/blogs":     {},
+				"https://goharbor.io/community": {},
+				"https://goharbor.io/docs":      {},
+				"https://nonrooturl/won'tgetadded": {
+					Type: sitemap.EdgeExternal},
 			},
 			"https://goharbor.io/community": {
-				"https://goharbor.io":           struct{}{},
-				"https://goharbor.io/blogs":     struct{}{},
-				"https://goharbor.io/community": struct{}{},
-				"https://goharbor.io/docs":      struct{}{},
+				"https://goharbor.io":           {},
+				"https://goharbor.io/blogs":     {},
+				"https://goharbor.io/community": {},
+				"https://goharbor.io/docs":      {},
 			},
 			"https://goharbor.io/docs": {
-				"https://goharbor.io":           struct{}{},
-				"https://goharbor.io/blogs":     struct{}{},
-				"https://goharbor.io/community": struct{}{},
-				"https://goharbor.io/docs":      struct{}{},
+				"https://goharbor.io":           {},
+				"https://goharbor.io/blogs":     {},
+				"https://goharbor.io/community": {},
+				"https://goharbor.io/docs":      {},
 			},
 		},
 	}
@@ -227,17 +260,17 @@ func Test_service_Start(t *testing.T) {
 	want2 := want1
 
 	want3 := &sitemap.SiteMap{
-		URLs: map[string]struct{}{
+		URLs: map[string]*sitemap.Node{
 			"https://goharbor.io": {},
 		},
-		Connections: make(map[string]map[string]struct{}),
+		Connections: make(map[string]map[string]sitemap.Edge),
 	}
 
 	want5 := &sitemap.SiteMap{
-		URLs: map[string]struct{}{
-			"https://example.com": {},
+		URLs: map[string]*sitemap.Node{
+			"https://example.com": {Error: "crawling failed"},
 		},
-		Connections: make(map[string]map[string]struct{}),
+		Connections: make(map[string]map[string]sitemap.Edge),
 	}
 
 	depth := 13
@@ -256,9 +289,9 @@ func Test_service_Start(t *testing.T) {
 			args: args{
 				u: u,
 				c: &CondConfig{
-					true,
-					&depth,
-					true,
+					rootOnly: true,
+					depth:    &depth,
+					debug:    true,
 				},
 				sm: sitemap.New(),
 			},
@@ -270,9 +303,9 @@ func Test_service_Start(t *testing.T) {
 			args: args{
 				u: u,
 				c: &CondConfig{
-					true,
-					nil,
-					true,
+					rootOnly: true,
+					depth:    nil,
+					debug:    true,
 				},
 				sm: sitemap.New(),
 			},
@@ -284,9 +317,9 @@ func Test_service_Start(t *testing.T) {
 			args: args{
 				u: u,
 				c: &CondConfig{
-					true,
-					&depth2,
-					true,
+					rootOnly: true,
+					depth:    &depth2,
+					debug:    true,
 				},
 				sm: sitemap.New(),
 			},
@@ -308,9 +341,9 @@ func Test_service_Start(t *testing.T) {
 			args: args{
 				u: uFail,
 				c: &CondConfig{
-					true,
-					&depth4,
-					true,
+					rootOnly: true,
+					depth:    &depth4,
+					debug:    true,
 				},
 				sm: sitemap.New(),
 			},
@@ -333,3 +366,1097 @@ func Test_service_Start(t *testing.T) {
 		})
 	}
 }
+
+type fakeRobotsClient struct{}
+
+func (f *fakeRobotsClient) Do(req *http.Request) (*http.Response, error) {
+	body := "User-agent: *\nDisallow: /blogs/\n" +
+		"Sitemap: https://goharbor.io/sitemap.xml\n"
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+func Test_service_StartRobots(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://goharbor.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	c := NewConfig(true, nil, true).
+		WithRobots(robots.NewCache(&fakeRobotsClient{}, "smap", l, true))
+
+	sm := New(u, &mockParser{}, l, c).Start()
+
+	wantURLs := map[string]int{
+		"https://goharbor.io":           0,
+		"https://goharbor.io/blogs":     1,
+		"https://goharbor.io/community": 1,
+		"https://goharbor.io/docs":      1,
+	}
+	if got := depths(sm); !reflect.DeepEqual(got, wantURLs) {
+		t.Errorf("URLs = %v, want %v", got, wantURLs)
+	}
+	wantSkipped := map[string]string{
+		"https://goharbor.io/blogs/harbor-joins-cncf": reasonRobots,
+		"https://goharbor.io/blogs/hello-world":       reasonRobots,
+	}
+	if !reflect.DeepEqual(sm.Skipped, wantSkipped) {
+		t.Errorf("Skipped = %v, want %v", sm.Skipped, wantSkipped)
+	}
+	wantSitemaps := map[string]struct{}{
+		"https://goharbor.io/sitemap.xml": {},
+	}
+	if !reflect.DeepEqual(sm.Sitemaps, wantSitemaps) {
+		t.Errorf("Sitemaps = %v, want %v", sm.Sitemaps, wantSitemaps)
+	}
+}
+
+func Test_service_StartContextCancelled(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://goharbor.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	sm := New(u, &mockParser{}, l, NewConfig(true, nil, true)).
+		StartContext(ctx)
+
+	want := map[string]*sitemap.Node{"https://goharbor.io": {}}
+	if !reflect.DeepEqual(sm.URLs, want) {
+		t.Errorf("URLs = %v, want %v", sm.URLs, want)
+	}
+}
+
+// depths gives the depth of every url of sm
+func depths(sm *sitemap.SiteMap) map[string]int {
+	d := make(map[string]int, len(sm.URLs))
+	for u, n := range sm.URLs {
+		d[u] = n.Depth
+	}
+	return d
+}
+
+func Test_service_StartShortestDepth(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	p := &fakeParser{pages: graph(map[string][]string{
+		"https://ex.io":        {"/long", "/short"},
+		"https://ex.io/long":   {"/longer"},
+		"https://ex.io/longer": {"/target"},
+		"https://ex.io/short":  {"/target"},
+		"https://ex.io/target": {"/child"},
+	})}
+	depth := 3
+
+	for i := 0; i < 10; i++ {
+		sm := New(u, p, l, NewConfig(true, &depth, true)).Start()
+		want := map[string]int{
+			"https://ex.io":        0,
+			"https://ex.io/long":   1,
+			"https://ex.io/short":  1,
+			"https://ex.io/longer": 2,
+			"https://ex.io/target": 2,
+			"https://ex.io/child":  3,
+		}
+		if got := depths(sm); !reflect.DeepEqual(got, want) {
+			t.Fatalf("URLs = %v, want %v", got, want)
+		}
+	}
+}
+
+func Test_service_StartFilter(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://goharbor.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	f, err := scope.NewFilter(nil, []string{"/blogs/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sm := New(u, &mockParser{}, l, NewConfig(true, nil, true).
+		WithFilter(f)).Start()
+
+	if _, ok := sm.URLs["https://goharbor.io/blogs/hello-world"]; ok {
+		t.Errorf("excluded url added to sitemap")
+	}
+	wantSkipped := map[string]string{
+		"https://goharbor.io/blogs/harbor-joins-cncf": "excluded by pattern /blogs/",
+		"https://goharbor.io/blogs/hello-world":       "excluded by pattern /blogs/",
+	}
+	if !reflect.DeepEqual(sm.Skipped, wantSkipped) {
+		t.Errorf("Skipped = %v, want %v", sm.Skipped, wantSkipped)
+	}
+}
+
+func Test_service_StartFollow(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+
+	p := &fakeParser{pages: map[string]*parser.Page{
+		"https://ex.io": {Links: []parser.Link{
+			{URL: "/page", Tag: "a", Attr: "href"},
+			{URL: "/frame", Tag: "iframe", Attr: "src"},
+			{URL: "/a.png", Tag: "img", Attr: "src"},
+			{URL: "https://cdn.io/app.js", Tag: "script", Attr: "src"},
+			{URL: "data:image/png;base64,AAAA", Tag: "img", Attr: "src"},
+		}},
+	}}
+
+	sm := New(u, p, l, NewConfig(true, nil, true).
+		WithFollow("a")).Start()
+
+	wantURLs := map[string]int{
+		"https://ex.io":      0,
+		"https://ex.io/page": 1,
+	}
+	if got := depths(sm); !reflect.DeepEqual(got, wantURLs) {
+		t.Errorf("URLs = %v, want %v", got, wantURLs)
+	}
+	wantResources := map[string]map[string]struct{}{
+		"https://ex.io": {
+			"https://ex.io/frame":   {},
+			"https://ex.io/a.png":   {},
+			"https://cdn.io/app.js": {},
+		},
+	}
+	if !reflect.DeepEqual(sm.Resources, wantResources) {
+		t.Errorf("Resources = %v, want %v", sm.Resources, wantResources)
+	}
+}
+
+func TestService_urlParse(t *testing.T) {
+	s := &Service{c: NewConfig(true, nil, false), norm: normalize.Default()}
+	u, _ := url.Parse("https://ex.io/docs/guide/install")
+	tests := []struct {
+		name string
+		base string
+		link string
+		want string
+	}{
+		{"relative", "", "setup", "https://ex.io/docs/guide/setup"},
+		{"parent", "", "../api#x", "https://ex.io/docs/api"},
+		{"absolute path", "", "/blog/", "https://ex.io/blog"},
+		{"scheme relative", "", "//cdn.io/a", "https://cdn.io/a"},
+		{"query only", "", "?page=2", "https://ex.io/docs/guide/install?page=2"},
+		{"base href", "https://other.io/v2/", "intro", "https://other.io/v2/intro"},
+		{"relative base href", "/v3/", "../intro", "https://ex.io/intro"},
+		{"normalized", "", "HTTPS://EX.io:443/a/%7Eb/", "https://ex.io/a/~b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := s.urlParse(s.baseURL(u, tt.base), tt.link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := l.String(); got != tt.want {
+				t.Errorf("urlParse() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeParser gives fixed pages, other urls fail
+// Loops are given along with ErrRedirectLoop, a request conditional
+// on the ETag of a page answers 304 and fetching crash cancels the crawl
+type fakeParser struct {
+	pages map[string]*parser.Page
+	// failures are given for a url before its page, nil for a 503
+	failures map[string][]error
+	crash    string
+	cancel   context.CancelFunc
+	// held urls are given once their channel is closed
+	held map[string]chan struct{}
+
+	mu            sync.Mutex
+	calls         map[string]int
+	notModified   []string
+	unconditional int
+}
+
+func (f *fakeParser) ExtractURLs(ctx context.Context, u string,
+	o parser.Options) (*parser.Page, error) {
+	if c, ok := f.held[u]; ok {
+		<-c
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[u]++
+	if u == f.crash {
+		f.cancel()
+	}
+	if errs := f.failures[u]; len(errs) > 0 {
+		f.failures[u] = errs[1:]
+		if errs[0] == nil {
+			return &parser.Page{Fetch: parser.Fetch{Status: 503}}, nil
+		}
+		return nil, errs[0]
+	}
+	p, ok := f.pages[u]
+	if !ok {
+		return nil, errors.New("crawling failed")
+	}
+	if o.Validators == nil {
+		f.unconditional++
+	} else if o.Validators.ETag == p.Fetch.ETag {
+		f.notModified = append(f.notModified, u)
+		return &parser.Page{Fetch: parser.Fetch{Status: 304}}, nil
+	}
+	// Crawls must not share what they get
+	cp := *p
+	if p.Fetch.Loop {
+		return &cp, parser.ErrRedirectLoop
+	}
+	return &cp, nil
+}
+
+// graph gives pages made of the urls linked from them
+func graph(links map[string][]string) map[string]*parser.Page {
+	pages := make(map[string]*parser.Page, len(links))
+	for u, l := range links {
+		pages[u] = page(l...)
+	}
+	return pages
+}
+
+func Test_service_StartRedirects(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	p := &fakeParser{pages: map[string]*parser.Page{
+		"https://ex.io": page("/old", "/loop", "/slash", "/away"),
+		"https://ex.io/old": {
+			Links: anchors("child"),
+			Fetch: parser.Fetch{
+				Status: 200,
+				Redirects: []parser.Redirect{
+					{URL: "https://ex.io/old", Status: 301},
+					{URL: "https://ex.io/older", Status: 302},
+				},
+				FinalURL: "https://ex.io/new/",
+			},
+		},
+		"https://ex.io/loop": {Fetch: parser.Fetch{
+			Status: 301,
+			Redirects: []parser.Redirect{
+				{URL: "https://ex.io/loop", Status: 301},
+				{URL: "https://ex.io/loop2", Status: 301},
+			},
+			FinalURL: "https://ex.io/loop",
+			Loop:     true,
+		}},
+		"https://ex.io/slash": {
+			Links: anchors("/"),
+			Fetch: parser.Fetch{
+				Status: 200,
+				Redirects: []parser.Redirect{
+					{URL: "https://ex.io/slash", Status: 301},
+				},
+				FinalURL: "https://ex.io/slash/",
+			},
+		},
+		"https://ex.io/away": {Fetch: parser.Fetch{
+			Status: 200,
+			Redirects: []parser.Redirect{
+				{URL: "https://ex.io/away", Status: 308},
+			},
+			FinalURL: "https://other.io/",
+		}},
+		"https://ex.io/new/child": page(),
+	}}
+
+	sm := New(u, p, l, NewConfig(true, nil, true).
+		WithMaxRedirectChain(1)).Start()
+
+	wantDepths := map[string]int{
+		"https://ex.io":           0,
+		"https://ex.io/old":       1,
+		"https://ex.io/older":     1,
+		"https://ex.io/new":       1,
+		"https://ex.io/new/child": 2,
+		"https://ex.io/loop":      1,
+		"https://ex.io/loop2":     1,
+		"https://ex.io/slash":     1,
+		"https://ex.io/away":      1,
+	}
+	if got := depths(sm); !reflect.DeepEqual(got, wantDepths) {
+		t.Errorf("URLs = %v, want %v", got, wantDepths)
+	}
+
+	redirect := func(status int) sitemap.Edge {
+		return sitemap.Edge{Type: sitemap.EdgeRedirect, Status: status}
+	}
+	edges := map[[2]string]sitemap.Edge{
+		{"https://ex.io/old", "https://ex.io/older"}:     redirect(301),
+		{"https://ex.io/older", "https://ex.io/new"}:     redirect(302),
+		{"https://ex.io/new", "https://ex.io/new/child"}: {},
+		{"https://ex.io/loop", "https://ex.io/loop2"}:    redirect(301),
+		{"https://ex.io/loop2", "https://ex.io/loop"}:    redirect(301),
+		{"https://ex.io/slash", "https://ex.io"}:         {},
+	}
+	for e, want := range edges {
+		got, ok := sm.Connections[e[0]][e[1]]
+		if !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("edge %s -> %s = %v, %v, want %v", e[0], e[1], got,
+				ok, want)
+		}
+	}
+
+	wantIssues := map[string][]string{
+		"https://ex.io/old":  {"redirect chain of 2 hops"},
+		"https://ex.io/loop": {"redirect loop", "redirect chain of 2 hops"},
+	}
+	for u, n := range sm.URLs {
+		if !reflect.DeepEqual(n.Issues, wantIssues[u]) {
+			t.Errorf("%s Issues = %v, want %v", u, n.Issues, wantIssues[u])
+		}
+	}
+	if sm.Skipped["https://other.io"] != reasonRedirectOutOfScope {
+		t.Errorf("Skipped = %v", sm.Skipped)
+	}
+	if n := sm.URLs["https://ex.io/slash"]; n.Fetch.Status != 200 {
+		t.Errorf("normalized redirect status = %d, want 200", n.Fetch.Status)
+	}
+	if n := sm.URLs["https://ex.io/old"]; n.Fetch.Status != 301 ||
+		n.Fetch.FinalURL != "https://ex.io/new/" {
+		t.Errorf("redirected fetch = %+v", n.Fetch)
+	}
+}
+
+// siteClient serves a site made of html pages and redirections, it
+// records the hosts and paths requested
+type siteClient struct {
+	pages     map[string]string
+	redirects map[string]string
+	robots    string
+
+	mu        sync.Mutex
+	requested []string
+}
+
+func (c *siteClient) Do(req *http.Request) (*http.Response, error) {
+	path := req.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	c.mu.Lock()
+	c.requested = append(c.requested, req.URL.Host+path)
+	c.mu.Unlock()
+
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/html"}},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}
+	if path == "/robots.txt" {
+		resp.Header.Set("Content-Type", "text/plain")
+		resp.Body = ioutil.NopCloser(strings.NewReader(c.robots))
+		return resp, nil
+	}
+	if loc, ok := c.redirects[path]; ok {
+		resp.StatusCode = http.StatusMovedPermanently
+		resp.Header.Set("Location", loc)
+		return resp, nil
+	}
+	body, ok := c.pages[path]
+	if !ok {
+		resp.StatusCode = http.StatusNotFound
+		return resp, nil
+	}
+	resp.Body = ioutil.NopCloser(strings.NewReader(body))
+	return resp, nil
+}
+
+func Test_service_StartRedirectsBlocked(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	client := &siteClient{
+		pages: map[string]string{
+			"/": `<a href="/go">go</a><a href="/news">news</a>` +
+				`<a href="/docs">docs</a><a href="/away">away</a>`,
+			"/private/secret": `<a href="/private/other">other</a>`,
+			"/blogs/2020":     `<a href="/blogs/2021">2021</a>`,
+			"/docs/":          "",
+		},
+		redirects: map[string]string{
+			"/go":   "/private/secret",
+			"/news": "/blogs/2020",
+			"/docs": "/docs/",
+			"/away": "https://evil.com/page",
+		},
+		robots: "User-agent: *\nDisallow: /private\n",
+	}
+	f, err := scope.NewFilter(nil, []string{"/blogs/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewConfig(true, nil, true).
+		WithRobots(robots.NewCache(client, "smap", l, true)).
+		WithFilter(f)
+
+	sm := New(u, parser.New(client, l, true, 2), l, c).Start()
+
+	want := map[string]int{
+		"https://ex.io":      0,
+		"https://ex.io/go":   1,
+		"https://ex.io/news": 1,
+		"https://ex.io/docs": 1,
+		"https://ex.io/away": 1,
+	}
+	if got := depths(sm); !reflect.DeepEqual(got, want) {
+		t.Errorf("URLs = %v, want %v", got, want)
+	}
+	wantSkipped := map[string]string{
+		"https://ex.io/private/secret": reasonRobots,
+		"https://ex.io/blogs/2020":     "excluded by pattern /blogs/",
+		"https://evil.com/page":        reasonRedirectOutOfScope,
+	}
+	if !reflect.DeepEqual(sm.Skipped, wantSkipped) {
+		t.Errorf("Skipped = %v, want %v", sm.Skipped, wantSkipped)
+	}
+	for _, p := range client.requested {
+		if strings.HasPrefix(p, "ex.io/private") ||
+			strings.HasPrefix(p, "ex.io/blogs") || !strings.HasPrefix(p, "ex.io/") {
+			t.Errorf("%s was requested", p)
+		}
+	}
+	if n := sm.URLs["https://ex.io/go"]; n.Fetch.Status != 301 ||
+		n.Fetch.FinalURL != "https://ex.io/private/secret" {
+		t.Errorf("blocked redirect fetch = %+v", n.Fetch)
+	}
+}
+
+func Test_service_StartRedirectsBroken(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	client := &siteClient{
+		pages: map[string]string{
+			"/": `<a href="/a">loop</a><a href="/c0">chain</a>`,
+		},
+		redirects: map[string]string{"/a": "/b", "/b": "/a"},
+	}
+	for i := 0; i <= redirect.DefaultMax; i++ {
+		client.redirects[fmt.Sprintf("/c%d", i)] = fmt.Sprintf("/c%d", i+1)
+	}
+
+	sm := New(u, parser.New(client, l, true, 2), l,
+		NewConfig(true, nil, true)).Start()
+
+	want := map[string]string{
+		"https://ex.io/a":  "redirect loop",
+		"https://ex.io/c0": "too many redirects",
+	}
+	got := make(map[string]string)
+	for _, b := range sm.BrokenLinks() {
+		got[b.URL] = b.Error
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BrokenLinks() = %v, want %v", got, want)
+	}
+}
+
+func Test_service_StartCrawlDelay(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	client := &siteClient{
+		pages: map[string]string{
+			"/":  `<a href="/a">a</a><a href="/b">b</a>`,
+			"/a": "",
+			"/b": "",
+		},
+		robots: "User-agent: *\nCrawl-delay: 0.05\n",
+	}
+	th := throttle.New(client, throttle.Config{}, l, true)
+	c := NewConfig(true, nil, true).
+		WithRobots(robots.NewCache(th, "smap", l, true)).
+		WithThrottle(th)
+
+	start := time.Now()
+	New(u, parser.New(th, l, true, 3), l, c).Start()
+
+	if len(client.requested) != 4 {
+		t.Fatalf("requests = %v, want robots.txt and 3 pages",
+			client.requested)
+	}
+	// Pages are booked 50ms apart, the last one can't start sooner
+	// than two Crawl-delays after the first one
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("crawl took %s, want at least two Crawl-delays of 50ms", d)
+	}
+}
+
+func Test_service_StartMedia(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	news := &parser.News{Language: "en", Published: "2018-08-07"}
+	p := &fakeParser{pages: map[string]*parser.Page{
+		"https://ex.io": {
+			Base:   "https://ex.io/docs/",
+			Images: []parser.Image{{URL: "a.png", Alt: "A"}, {URL: "%zz"}},
+			Videos: []parser.Video{
+				{ContentURL: "v.mp4", ThumbnailURL: "//cdn.io/v.jpg"},
+				{ContentURL: "mailto:a@ex.io"},
+			},
+			News: news,
+		},
+	}}
+
+	sm := New(u, p, l, NewConfig(true, nil, true)).Start()
+
+	n := sm.URLs["https://ex.io"]
+	images := []parser.Image{{URL: "https://ex.io/docs/a.png", Alt: "A"}}
+	if !reflect.DeepEqual(n.Images, images) {
+		t.Errorf("Images = %v, want %v", n.Images, images)
+	}
+	videos := []parser.Video{{ContentURL: "https://ex.io/docs/v.mp4",
+		ThumbnailURL: "https://cdn.io/v.jpg"}}
+	if !reflect.DeepEqual(n.Videos, videos) {
+		t.Errorf("Videos = %v, want %v", n.Videos, videos)
+	}
+	if n.News != news {
+		t.Errorf("News = %v, want %v", n.News, news)
+	}
+}
+
+func Test_service_StartHreflang(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	alternate := func(lang, href string) parser.Link {
+		return parser.Link{URL: href, Tag: "link", Attr: "href",
+			Rel: "alternate", Hreflang: lang}
+	}
+	p := &fakeParser{pages: map[string]*parser.Page{
+		"https://ex.io": {Links: []parser.Link{
+			alternate("x-default", "/"),
+			alternate("fr", "/fr/"),
+			alternate("de", "https://ex.de/"),
+		}},
+		"https://ex.io/fr": {Links: []parser.Link{
+			alternate("x-default", "/"),
+			alternate("fr", "/fr/"),
+		}},
+	}}
+
+	sm := New(u, p, l, NewConfig(true, nil, true).WithFollow("a")).Start()
+
+	want := map[string]map[string]string{
+		"https://ex.io": {
+			"x-default": "https://ex.io",
+			"fr":        "https://ex.io/fr",
+			"de":        "https://ex.de",
+		},
+		"https://ex.io/fr": {
+			"x-default": "https://ex.io",
+			"fr":        "https://ex.io/fr",
+		},
+	}
+	if !reflect.DeepEqual(sm.Alternates, want) {
+		t.Errorf("Alternates = %v, want %v", sm.Alternates, want)
+	}
+	e := sm.Connections["https://ex.io"]["https://ex.io/fr"]
+	if e.Type != sitemap.EdgeAlternate {
+		t.Errorf("edge type = %q, want %q", e.Type, sitemap.EdgeAlternate)
+	}
+	if _, ok := sm.URLs["https://ex.de"]; ok {
+		t.Errorf("out of scope alternate crawled")
+	}
+}
+
+func Test_service_StartNofollow(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	root := page("/a", "/b")
+	root.Links[1].Rel = "nofollow noopener"
+	root.Canonical = "https://ex.io/"
+	p := &fakeParser{pages: map[string]*parser.Page{
+		"https://ex.io": root,
+		"https://ex.io/a": {Links: anchors("/c"), NoFollow: true,
+			NoIndex: true, Canonical: "/"},
+		"https://ex.io/b": page(),
+		"https://ex.io/c": page(),
+	}}
+
+	tests := []struct {
+		name     string
+		nofollow bool
+		want     map[string]int
+	}{
+		{"ignored", false, map[string]int{"https://ex.io": 0,
+			"https://ex.io/a": 1, "https://ex.io/b": 1,
+			"https://ex.io/c": 2}},
+		{"respected", true, map[string]int{"https://ex.io": 0,
+			"https://ex.io/a": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := New(u, p, l, NewConfig(true, nil, true).
+				WithNofollow(tt.nofollow)).Start()
+			if got := depths(sm); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("URLs = %v, want %v", got, tt.want)
+			}
+
+			n := sm.URLs["https://ex.io/a"]
+			if !n.NoIndex || !n.NoFollow || n.Canonical != "https://ex.io" {
+				t.Errorf("https://ex.io/a node = %+v", n)
+			}
+			want := map[string]map[string]struct{}{"https://ex.io": {
+				"https://ex.io": {}, "https://ex.io/a": {}}}
+			if !reflect.DeepEqual(sm.Canonicals, want) {
+				t.Errorf("Canonicals = %v, want %v", sm.Canonicals, want)
+			}
+		})
+	}
+}
+
+// fakeSitemapClient serves robots.txt announcing a sitemap
+type fakeSitemapClient struct{}
+
+func (f *fakeSitemapClient) Do(req *http.Request) (*http.Response, error) {
+	body := ""
+	switch req.URL.Path {
+	case "/robots.txt":
+		body = "Sitemap: https://ex.io/pages.xml\n"
+	case "/pages.xml":
+		body = `<urlset><url><loc>https://ex.io/a</loc></url>` +
+			`<url><loc>https://ex.io/orphan/</loc></url>` +
+			`<url><loc>https://other.io/</loc></url></urlset>`
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+func Test_service_StartSitemapSeeds(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	p := &fakeParser{pages: map[string]*parser.Page{
+		"https://ex.io":              page("/a"),
+		"https://ex.io/a":            page(),
+		"https://ex.io/orphan":       page("/orphan/child", "/a"),
+		"https://ex.io/orphan/child": page(),
+	}}
+	client := &fakeSitemapClient{}
+	c := NewConfig(true, nil, true).
+		WithRobots(robots.NewCache(client, "smap", l, true)).
+		WithSitemapSeeds(seed.NewLoader(client, l, true))
+
+	sm := New(u, p, l, c).Start()
+
+	want := map[string]int{
+		"https://ex.io":              0,
+		"https://ex.io/a":            1,
+		"https://ex.io/orphan":       0,
+		"https://ex.io/orphan/child": 1,
+	}
+	if got := depths(sm); !reflect.DeepEqual(got, want) {
+		t.Errorf("URLs = %v, want %v", got, want)
+	}
+	flags := map[string][2]bool{
+		"https://ex.io":              {false, false},
+		"https://ex.io/a":            {true, false},
+		"https://ex.io/orphan":       {true, true},
+		"https://ex.io/orphan/child": {false, false},
+	}
+	for u, f := range flags {
+		n := sm.URLs[u]
+		if n.InSitemap != f[0] || n.Orphan != f[1] {
+			t.Errorf("%s InSitemap, Orphan = %v, %v, want %v, %v", u,
+				n.InSitemap, n.Orphan, f[0], f[1])
+		}
+	}
+}
+
+func Test_service_StartSeeds(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://www.ex.io")
+	blog, _ := url.Parse("https://blog.ex.io/")
+	docs, _ := url.Parse("https://docs.ex.io/intro")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	p := &fakeParser{pages: graph(map[string][]string{
+		"https://www.ex.io":        {"/about", "https://blog.ex.io/post"},
+		"https://blog.ex.io":       {"/post", "https://other.io"},
+		"https://blog.ex.io/post":  {"https://www.ex.io/about"},
+		"https://docs.ex.io/intro": {"/install"},
+	})}
+
+	sm := New(u, p, l, NewConfig(true, nil, true).
+		WithSeeds(blog, docs, u)).Start()
+
+	want := map[string]int{
+		"https://www.ex.io":          0,
+		"https://www.ex.io/about":    1,
+		"https://blog.ex.io":         0,
+		"https://blog.ex.io/post":    1,
+		"https://docs.ex.io/intro":   0,
+		"https://docs.ex.io/install": 1,
+	}
+	if got := depths(sm); !reflect.DeepEqual(got, want) {
+		t.Errorf("URLs = %v, want %v", got, want)
+	}
+}
+
+func Test_service_StartHostHeldBack(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://slow.ex.io")
+	www, _ := url.Parse("https://www.ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	held := make(chan struct{})
+	p := &fakeParser{
+		pages: graph(map[string][]string{
+			"https://slow.ex.io": {},
+			"https://www.ex.io":  {},
+		}),
+		held: map[string]chan struct{}{"https://slow.ex.io": held},
+	}
+
+	// slow.ex.io is given once www.ex.io is fetched, which needs a
+	// worker of its own
+	fetched := make(chan bool, 1)
+	go func() {
+		defer close(held)
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+			p.mu.Lock()
+			n := p.calls["https://www.ex.io"]
+			p.mu.Unlock()
+			if n > 0 {
+				fetched <- true
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		fetched <- false
+	}()
+
+	New(u, p, l, NewConfig(true, nil, true).WithWorkers(1).
+		WithSeeds(www)).Start()
+	if !<-fetched {
+		t.Errorf("www.ex.io waited for the host held back")
+	}
+}
+
+func Test_service_StartRetry(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	timeout := &url.Error{Op: "Get", URL: "https://ex.io/b",
+		Err: context.DeadlineExceeded}
+	ok := parser.Fetch{Status: 200}
+	root := page("/a", "/b", "/c", "/d")
+	root.Fetch = ok
+	p := &fakeParser{
+		pages: map[string]*parser.Page{
+			"https://ex.io":   root,
+			"https://ex.io/a": {Fetch: ok},
+			"https://ex.io/b": {Fetch: ok},
+			"https://ex.io/c": {Fetch: ok},
+			"https://ex.io/d": {Fetch: ok},
+		},
+		failures: map[string][]error{
+			"https://ex.io/a": {nil, nil},
+			"https://ex.io/b": {timeout, timeout, timeout},
+			"https://ex.io/c": {errors.New("unsupported protocol")},
+			"https://ex.io/d": {nil, nil, nil},
+		},
+	}
+
+	sm := New(u, p, l, NewConfig(true, nil, true).
+		WithRetry(retry.New(3, time.Millisecond))).Start()
+
+	wantCalls := map[string]int{
+		"https://ex.io":   1,
+		"https://ex.io/a": 3,
+		"https://ex.io/b": 3,
+		"https://ex.io/c": 1,
+		"https://ex.io/d": 3,
+	}
+	if !reflect.DeepEqual(p.calls, wantCalls) {
+		t.Errorf("calls = %v, want %v", p.calls, wantCalls)
+	}
+
+	tests := []struct {
+		url      string
+		status   int
+		attempts int
+		err      string
+	}{
+		{"https://ex.io", 200, 0, ""},
+		{"https://ex.io/a", 200, 3, ""},
+		{"https://ex.io/b", 0, 3, timeout.Error()},
+		{"https://ex.io/c", 0, 0, "unsupported protocol"},
+		{"https://ex.io/d", 503, 3, ""},
+	}
+	for _, tt := range tests {
+		n := sm.URLs[tt.url]
+		status := 0
+		if n.Fetch != nil {
+			status = n.Fetch.Status
+		}
+		if status != tt.status || n.Attempts != tt.attempts ||
+			n.Error != tt.err {
+			t.Errorf("%s Status, Attempts, Error = %d, %d, %q,"+
+				" want %d, %d, %q", tt.url, status, n.Attempts, n.Error,
+				tt.status, tt.attempts, tt.err)
+		}
+	}
+}
+
+func Test_service_StartResume(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	pages := graph(map[string][]string{
+		"https://ex.io":          {"/a", "/b", "/c"},
+		"https://ex.io/a":        {"/a/1", "/b"},
+		"https://ex.io/b":        {"/b/1", "/b/2"},
+		"https://ex.io/c":        {"/c/1"},
+		"https://ex.io/b/1":      {"/b/1/deep", "/a"},
+		"https://ex.io/c/1":      {"/c/1/deep"},
+		"https://ex.io/c/1/deep": {"/"},
+	})
+	want := New(u, &fakeParser{pages: pages}, l,
+		NewConfig(true, nil, true)).Start()
+
+	st := checkpoint.New(t.TempDir())
+	newConfig := func() *CondConfig {
+		c := NewConfig(true, nil, true).WithCheckpoint(st, 0)
+		c.batch = 1
+		return c
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := &fakeParser{pages: pages, crash: "https://ex.io/b/1",
+		cancel: cancel}
+	New(u, p, l, newConfig()).StartContext(ctx)
+
+	state, err := st.Load()
+	if err != nil {
+		t.Fatal("no checkpoint after interruption:", err)
+	}
+	if state.Depth != 2 || len(state.Frontier) == 0 ||
+		state.Frontier[0] != "https://ex.io/b/1" {
+		t.Errorf("checkpoint at depth %d with frontier %v, want depth 2"+
+			" from https://ex.io/b/1", state.Depth, state.Frontier)
+	}
+
+	got := New(u, &fakeParser{pages: pages}, l,
+		newConfig().WithResume(state)).Start()
+	if !reflect.DeepEqual(depths(got), depths(want)) {
+		t.Errorf("URLs = %v, want %v", depths(got), depths(want))
+	}
+	if !reflect.DeepEqual(got.Connections, want.Connections) {
+		t.Errorf("Connections = %v, want %v", got.Connections,
+			want.Connections)
+	}
+	if _, err := st.Load(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("checkpoint left once the crawl is over: %v", err)
+	}
+}
+
+func Test_service_StartPrevious(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	tagged := func(etag string, links ...string) *parser.Page {
+		p := page(links...)
+		p.Fetch = parser.Fetch{Status: 200, ETag: etag}
+		return p
+	}
+	a := tagged(`"1"`, "/a/1")
+	a.Links = append(a.Links,
+		parser.Link{URL: "/logo.png", Tag: "img", Attr: "src"})
+	p := &fakeParser{pages: map[string]*parser.Page{
+		"https://ex.io":     tagged(`"1"`, "/a", "/b", "/private/x"),
+		"https://ex.io/a":   a,
+		"https://ex.io/b":   tagged(`"1"`, "/b/1"),
+		"https://ex.io/a/1": tagged(`"1"`, "/"),
+		"https://ex.io/b/1": tagged(""),
+		"https://ex.io/b/2": tagged(""),
+	}}
+	f, err := scope.NewFilter(nil, []string{"/private/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := New(u, p, l, NewConfig(true, nil, true).WithFilter(f)).Start()
+
+	p.pages["https://ex.io/b"] = tagged(`"2"`, "/b/2")
+	p.unconditional = 0
+	sm := New(u, p, l, NewConfig(true, nil, true).WithFilter(f).
+		WithPrevious(prev)).Start()
+
+	want := map[string]int{
+		"https://ex.io":     0,
+		"https://ex.io/a":   1,
+		"https://ex.io/b":   1,
+		"https://ex.io/a/1": 2,
+		"https://ex.io/b/2": 2,
+	}
+	if got := depths(sm); !reflect.DeepEqual(got, want) {
+		t.Errorf("URLs = %v, want %v", got, want)
+	}
+	wantSkipped := map[string]string{
+		"https://ex.io/private/x": "excluded by pattern /private/",
+	}
+	if !reflect.DeepEqual(sm.Skipped, wantSkipped) {
+		t.Errorf("Skipped = %v, want %v", sm.Skipped, wantSkipped)
+	}
+	if p.unconditional != 1 {
+		t.Errorf("unconditional requests = %d, want 1 for b/2",
+			p.unconditional)
+	}
+	if len(p.notModified) != 3 {
+		t.Errorf("304 for %v, want ex.io, a and a/1", p.notModified)
+	}
+	for _, link := range p.notModified {
+		if f := sm.URLs[link].Fetch; !f.NotModified || f.Status != 200 ||
+			f.ETag != `"1"` {
+			t.Errorf("%s Fetch = %+v, want the previous one not modified",
+				link, f)
+		}
+	}
+	if !reflect.DeepEqual(sm.Resources, prev.Resources) {
+		t.Errorf("Resources = %v, want %v", sm.Resources, prev.Resources)
+	}
+
+	sm.Compare(prev)
+	wantChanges := &sitemap.Changes{
+		Added:     []string{"https://ex.io/b/2"},
+		Changed:   []string{"https://ex.io/b"},
+		Removed:   []string{"https://ex.io/b/1"},
+		Unchanged: 3,
+	}
+	if !reflect.DeepEqual(sm.Changes, wantChanges) {
+		t.Errorf("Changes = %+v, want %+v", sm.Changes, wantChanges)
+	}
+}
+
+// externalClient answers 404 to urls of other.io/404 and 200 otherwise
+type externalClient struct{}
+
+func (externalClient) Do(req *http.Request) (*http.Response, error) {
+	status := http.StatusOK
+	if req.URL.Path == "/404" {
+		status = http.StatusNotFound
+	}
+	return &http.Response{StatusCode: status, Header: http.Header{},
+		Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+}
+
+func Test_service_StartExternalCheck(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	p := &fakeParser{pages: map[string]*parser.Page{
+		"https://ex.io": {
+			Links: []parser.Link{
+				{URL: "/missing", Tag: "a", Attr: "href", Text: "Missing"},
+				{URL: "https://other.io/404", Tag: "a", Attr: "href",
+					Text: "Dead"},
+				{URL: "https://other.io", Tag: "a", Attr: "href"},
+				{URL: "mailto:me@ex.io", Tag: "a", Attr: "href"},
+			},
+			Fetch: parser.Fetch{Status: 200},
+		},
+		"https://ex.io/missing": {Fetch: parser.Fetch{Status: 404}},
+	}}
+
+	sm := New(u, p, l, NewConfig(true, nil, true).WithExternalCheck(
+		linkcheck.New(externalClient{}, l, true), 1)).Start()
+
+	want := []sitemap.BrokenLink{
+		{URL: "https://ex.io/missing", Status: 404, Sources: []sitemap.Source{
+			{Page: "https://ex.io", Text: "Missing"},
+		}},
+		{URL: "https://other.io/404", Status: 404, External: true,
+			Sources: []sitemap.Source{{Page: "https://ex.io", Text: "Dead",
+				Type: sitemap.EdgeExternal}}},
+	}
+	if got := sm.BrokenLinks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("BrokenLinks() = %+v, want %+v", got, want)
+	}
+	if len(sm.External) != 2 {
+		t.Errorf("External = %v, want other.io and other.io/404",
+			sm.External)
+	}
+}
+
+func Test_service_StartFragments(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	u, _ := url.Parse("https://ex.io")
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	html := parser.Fetch{Status: 200, ContentType: "text/html"}
+	p := &fakeParser{pages: map[string]*parser.Page{
+		"https://ex.io": {
+			Links: []parser.Link{
+				{URL: "/docs#install", Tag: "a", Attr: "href",
+					Text: "Install"},
+				{URL: "/docs#setup", Tag: "a", Attr: "href", Text: "Setup"},
+				{URL: "#intro", Tag: "a", Attr: "href", Text: "Intro"},
+				{URL: "#top", Tag: "a", Attr: "href"},
+				{URL: "/missing#x", Tag: "a", Attr: "href"},
+			},
+			Anchors: []string{"main"},
+			Fetch:   html,
+		},
+		"https://ex.io/docs": {
+			Anchors: []string{"install"},
+			Fetch:   html,
+		},
+		"https://ex.io/missing": {Fetch: parser.Fetch{Status: 404}},
+	}}
+
+	sm := New(u, p, l, NewConfig(true, nil, true)).Start()
+
+	wantEdge := sitemap.Edge{Text: "Install",
+		Fragments: map[string]string{"install": "Install", "setup": "Setup"}}
+	if got := sm.Connections["https://ex.io"]["https://ex.io/docs"]; !reflect.DeepEqual(got, wantEdge) {
+		t.Errorf("edge to docs = %+v, want %+v", got, wantEdge)
+	}
+	if got := sm.URLs["https://ex.io/docs"].Anchors; !reflect.DeepEqual(
+		got, []string{"install"}) {
+		t.Errorf("docs Anchors = %v, want [install]", got)
+	}
+
+	want := []sitemap.BrokenFragment{
+		{Page: "https://ex.io", URL: "https://ex.io", Fragment: "intro",
+			Text: "Intro"},
+		{Page: "https://ex.io", URL: "https://ex.io/docs",
+			Fragment: "setup", Text: "Setup"},
+	}
+	if got := sm.BrokenFragments(); !reflect.DeepEqual(got, want) {
+		t.Errorf("BrokenFragments() = %+v, want %+v", got, want)
+	}
+}
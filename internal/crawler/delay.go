@@ -0,0 +1,25 @@
+package crawler
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/khrm/smap/internal/throttle"
+)
+
+// WithThrottle makes the crawler space out requests to every host as
+// asked by the Crawl-delay of its robots.txt through t, the client the
+// parser makes requests with
+func (c *CondConfig) WithThrottle(t *throttle.Client) *CondConfig {
+	c.throttle = t
+	return c
+}
+
+// crawlDelay passes the Crawl-delay of the robots.txt of the host of u
+// to the throttle, before a request is made to it
+func (s *Service) crawlDelay(ctx context.Context, u *url.URL) {
+	if s.c.robots == nil || s.c.throttle == nil {
+		return
+	}
+	s.c.throttle.SetHostDelay(u.Host, s.c.robots.CrawlDelay(ctx, u))
+}
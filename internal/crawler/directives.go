@@ -0,0 +1,35 @@
+package crawler
+
+import (
+	"net/url"
+
+	"github.com/khrm/smap/internal/parser"
+	"github.com/khrm/smap/internal/sitemap"
+)
+
+// setDirectives saves the robots directives and the canonical url
+// of page on the node of u, canonical url is resolved against base
+func (s *Service) setDirectives(u string, base *url.URL,
+	page *parser.Page) {
+	if page.NoIndex || page.NoFollow {
+		s.sm.UpdateNode(u, func(n *sitemap.Node) {
+			n.NoIndex = page.NoIndex
+			n.NoFollow = page.NoFollow
+		})
+	}
+	if page.Canonical == "" {
+		return
+	}
+	c, err := s.urlParse(base, page.Canonical)
+	if err != nil {
+		return
+	}
+	s.sm.AddCanonical(u, c.String())
+}
+
+// nofollowed tells whether link l of page mustn't be crawled because
+// of a nofollow directive, they are only respected when configured
+func (s *Service) nofollowed(page *parser.Page, l parser.Link) bool {
+	return s.c.nofollow &&
+		(page.NoFollow || parser.HasRel(l.Rel, "nofollow"))
+}
@@ -0,0 +1,75 @@
+package crawler
+
+import (
+	"context"
+	"net/url"
+	"sync"
+
+	"github.com/khrm/smap/internal/linkcheck"
+	"github.com/khrm/smap/internal/parser"
+	"github.com/khrm/smap/internal/scope"
+	"github.com/khrm/smap/internal/sitemap"
+)
+
+// defaultCheckers is the number of external urls checked in parallel
+// when it isn't configured, it's kept low as they are on other sites
+const defaultCheckers = 2
+
+// WithExternalCheck makes the crawler check the urls of external edges
+// with ch once the crawl is over, workers of them in parallel
+// Every url is checked once
+func (c *CondConfig) WithExternalCheck(ch *linkcheck.Checker,
+	workers uint) *CondConfig {
+	c.checker = ch
+	c.checkers = workers
+	return c
+}
+
+// external records link l of page, out of the crawl scope,
+// as an external edge
+func (s *Service) external(page string, l *url.URL, pl parser.Link) {
+	if !scope.Any().InScope(l) {
+		return
+	}
+	s.sm.AddEdge(page, l.String(),
+		sitemap.Edge{Type: sitemap.EdgeExternal, Text: pl.Text})
+}
+
+// checkExternal checks every url of the external edges
+func (s *Service) checkExternal(ctx context.Context) {
+	if s.c.checker == nil {
+		return
+	}
+
+	workers := int(s.c.checkers)
+	if workers == 0 {
+		workers = defaultCheckers
+	}
+	jobs := make(chan string)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range jobs {
+				r := s.c.checker.Check(ctx, u)
+				if ctx.Err() != nil {
+					continue
+				}
+				if s.c.debug && r.Broken() {
+					s.log.Println("external link:", u, "is broken", r.Status,
+						r.Error)
+				}
+				s.sm.SetExternal(u, r)
+			}
+		}()
+	}
+	for _, u := range s.sm.ExternalLinks() {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- u
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,28 @@
+package crawler
+
+import (
+	"net/url"
+
+	"github.com/khrm/smap/internal/parser"
+	"github.com/khrm/smap/internal/sitemap"
+)
+
+// fragments gives the fragment of link l along with its text,
+// it's lost once the link is normalized
+func fragments(l parser.Link) map[string]string {
+	u, err := url.Parse(l.URL)
+	if err != nil || u.Fragment == "" {
+		return nil
+	}
+	return map[string]string{u.Fragment: l.Text}
+}
+
+// setAnchors records the anchors of page as the ones of link
+func (s *Service) setAnchors(link string, page *parser.Page) {
+	if len(page.Anchors) == 0 {
+		return
+	}
+	s.sm.UpdateNode(link, func(n *sitemap.Node) {
+		n.Anchors = page.Anchors
+	})
+}
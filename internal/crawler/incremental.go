@@ -0,0 +1,111 @@
+package crawler
+
+import (
+	"net/url"
+	"sort"
+
+	"github.com/khrm/smap/internal/parser"
+	"github.com/khrm/smap/internal/sitemap"
+)
+
+// WithPrevious makes the crawler fetch pages of prev, the sitemap of
+// a previous crawl, with conditional requests
+// Pages answering 304 keep the links and details they had in prev
+func (c *CondConfig) WithPrevious(prev *sitemap.SiteMap) *CondConfig {
+	c.prev = prev
+	return c
+}
+
+// previous gives the node of u in the previous crawl if its page
+// was got and can be requested again conditionally
+func (s *Service) previous(u *url.URL) (*sitemap.Node, bool) {
+	if s.c.prev == nil {
+		return nil, false
+	}
+	n, ok := s.c.prev.URLs[u.String()]
+	if !ok || n.Fetch == nil || n.Fetch.Status != 200 ||
+		len(n.Fetch.Redirects) > 0 {
+		return nil, false
+	}
+	return n, n.Fetch.ETag != "" || n.Fetch.LastModified != ""
+}
+
+// validators gives the validators of the previous fetch of u which
+// make its request conditional, nil if it can't be conditional
+func (s *Service) validators(u *url.URL) *parser.Validators {
+	n, ok := s.previous(u)
+	if !ok {
+		return nil
+	}
+	return &parser.Validators{
+		ETag:         n.Fetch.ETag,
+		LastModified: n.Fetch.LastModified,
+	}
+}
+
+// reuse gives the page of u as it was in the previous crawl if it
+// answered 304, page is returned as is otherwise
+// Resources of the page are added to the sitemap
+func (s *Service) reuse(u *url.URL, page *parser.Page) *parser.Page {
+	if page == nil || page.Fetch.Status != 304 {
+		return page
+	}
+	n, ok := s.previous(u)
+	if !ok {
+		return page
+	}
+	if s.c.debug {
+		s.log.Println("link:", u, "isn't modified, reusing its links")
+	}
+
+	link := u.String()
+	f := *n.Fetch
+	f.NotModified = true
+	f.ResponseTime = page.Fetch.ResponseTime
+	reused := &parser.Page{
+		Title:     n.Title,
+		Modified:  n.Modified,
+		Canonical: n.Canonical,
+		Anchors:   n.Anchors,
+		NoIndex:   n.NoIndex,
+		NoFollow:  n.NoFollow,
+		Images:    n.Images,
+		Videos:    n.Videos,
+		News:      n.News,
+		Fetch:     f,
+	}
+	for v, e := range s.c.prev.Connections[link] {
+		if e.Type != sitemap.EdgeLink && e.Type != sitemap.EdgeExternal {
+			continue
+		}
+		reused.Links = append(reused.Links, parser.Link{URL: v,
+			Tag: "a", Attr: "href", Text: e.Text})
+		for f, text := range e.Fragments {
+			reused.Links = append(reused.Links, parser.Link{
+				URL: v + "#" + (&url.URL{Fragment: f}).EscapedFragment(),
+				Tag: "a", Attr: "href", Text: text})
+		}
+	}
+	// Links which weren't crawled are checked again, so that they
+	// are listed as skipped as well
+	for _, v := range n.SkippedLinks {
+		reused.Links = append(reused.Links, parser.Link{URL: v,
+			Tag: "a", Attr: "href"})
+	}
+	for lang, v := range s.c.prev.Alternates[link] {
+		reused.Links = append(reused.Links, parser.Link{URL: v,
+			Tag: "link", Attr: "href", Rel: "alternate", Hreflang: lang})
+	}
+	for r := range s.c.prev.Resources[link] {
+		s.sm.AddResource(link, r)
+	}
+	// Links are sorted so that next level is the same between runs
+	sort.Slice(reused.Links, func(i, j int) bool {
+		a, b := reused.Links[i], reused.Links[j]
+		if a.URL != b.URL {
+			return a.URL < b.URL
+		}
+		return a.Hreflang < b.Hreflang
+	})
+	return reused
+}
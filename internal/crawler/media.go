@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"net/url"
+
+	"github.com/khrm/smap/internal/parser"
+	"github.com/khrm/smap/internal/scope"
+	"github.com/khrm/smap/internal/sitemap"
+)
+
+// setMedia saves images, videos and news of page on the node of u
+// Their urls are resolved against base, the ones which can't be
+// are left out
+func (s *Service) setMedia(u string, base *url.URL, page *parser.Page) {
+	var images []parser.Image
+	for _, i := range page.Images {
+		if i.URL = resolve(base, i.URL); i.URL != "" {
+			images = append(images, i)
+		}
+	}
+	var videos []parser.Video
+	for _, v := range page.Videos {
+		v.ContentURL = resolve(base, v.ContentURL)
+		v.PlayerURL = resolve(base, v.PlayerURL)
+		v.ThumbnailURL = resolve(base, v.ThumbnailURL)
+		if v.ContentURL != "" || v.PlayerURL != "" {
+			videos = append(videos, v)
+		}
+	}
+	if len(images) == 0 && len(videos) == 0 && page.News == nil {
+		return
+	}
+
+	s.sm.UpdateNode(u, func(n *sitemap.Node) {
+		n.Images = images
+		n.Videos = videos
+		n.News = page.News
+	})
+}
+
+// resolve gives the absolute form of ref, empty if it isn't
+// a valid http(s) url
+func resolve(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	r = base.ResolveReference(r)
+	if !scope.Any().InScope(r) {
+		return ""
+	}
+	return r.String()
+}
@@ -0,0 +1,140 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/khrm/smap/internal/parser"
+	"github.com/khrm/smap/internal/sitemap"
+)
+
+// reasonRedirectOutOfScope is recorded in sitemap for redirection
+// targets out of the crawl scope
+const reasonRedirectOutOfScope = "redirect target out of scope"
+
+// followRedirects records the redirections followed when fetching u
+// as redirect edges, every target becoming a url of the sitemap at
+// the same depth as u
+// It returns the url where the content was found and false if the
+// content must not be used, i.e. on a loop or a target out of scope,
+// excluded or disallowed by robots.txt
+func (s *Service) followRedirects(ctx context.Context, u *url.URL,
+	f *parser.Fetch, depth int) (*url.URL, bool) {
+	link := u.String()
+	if len(f.Redirects) == 0 {
+		s.sm.SetFetch(link, f)
+		return u, true
+	}
+
+	cur := u
+	hops := 0
+	defer func() {
+		if f.Loop {
+			s.sm.AddIssue(link, "redirect loop")
+		}
+		if s.c.maxChain > 0 && hops > s.c.maxChain {
+			s.sm.AddIssue(link, fmt.Sprintf(
+				"redirect chain of %d hops", hops))
+		}
+	}()
+
+	for i, r := range f.Redirects {
+		next := f.FinalURL
+		if i+1 < len(f.Redirects) {
+			next = f.Redirects[i+1].URL
+		}
+		if next == "" {
+			// Chain was cut, there were too many redirections
+			s.setRedirectFetch(u, cur, f, r.Status)
+			return nil, false
+		}
+		t, err := url.Parse(next)
+		if err != nil {
+			return nil, false
+		}
+		t = s.norm.Normalize(t)
+		// i.e. /docs redirecting to /docs/ is the same url once normalized
+		if t.String() == cur.String() {
+			continue
+		}
+
+		hops++
+		s.setRedirectFetch(u, cur, f, r.Status)
+		if !s.scope.InScope(t) {
+			s.sm.AddSkipped(t.String(), reasonRedirectOutOfScope)
+			return nil, false
+		}
+		if !s.filtered(t) || !s.allowed(ctx, t) {
+			return nil, false
+		}
+		added := s.sm.AddURL(t.String(), depth)
+		s.sm.AddEdge(cur.String(), t.String(), sitemap.Edge{
+			Type:   sitemap.EdgeRedirect,
+			Status: r.Status,
+		})
+		cur = t
+		// Url is already known, it's crawled on its own
+		if !added {
+			return nil, false
+		}
+	}
+
+	if f.Loop {
+		return nil, false
+	}
+	final := *f
+	final.Redirects = nil
+	final.FinalURL = ""
+	s.sm.SetFetch(cur.String(), &final)
+	return cur, true
+}
+
+// redirectAllowed gives the check made by the parser before following
+// a redirection, targets must be in scope and pass include and exclude
+// patterns and robots.txt so that they aren't requested otherwise
+// followRedirects records the targets refused as skipped
+func (s *Service) redirectAllowed(ctx context.Context) func(*url.URL) bool {
+	return func(t *url.URL) bool {
+		t = s.norm.Normalize(t)
+		if !s.scope.InScope(t) {
+			return false
+		}
+		if s.c.filter != nil {
+			if ok, _ := s.c.filter.Check(t); !ok {
+				return false
+			}
+		}
+		return s.c.robots == nil || s.c.robots.Allowed(ctx, t)
+	}
+}
+
+// setRedirectFetch records that cur answered with a redirection
+// The url first requested, u, also keeps the whole chain
+func (s *Service) setRedirectFetch(u, cur *url.URL, f *parser.Fetch,
+	status int) {
+	if cur != u {
+		s.sm.SetFetch(cur.String(), &parser.Fetch{Status: status})
+		return
+	}
+	s.sm.SetFetch(cur.String(), &parser.Fetch{
+		Status:    status,
+		Redirects: f.Redirects,
+		FinalURL:  f.FinalURL,
+		Loop:      f.Loop,
+	})
+}
+
+// documentURL gives the url the document fetched for u was served
+// from, links of the document are relative to it and not to its
+// normalized form
+func documentURL(u *url.URL, f *parser.Fetch) *url.URL {
+	if f.FinalURL == "" {
+		return u
+	}
+	d, err := url.Parse(f.FinalURL)
+	if err != nil {
+		return u
+	}
+	return d
+}
@@ -0,0 +1,55 @@
+package crawler
+
+import (
+	"context"
+	"net/url"
+	"sort"
+
+	"github.com/khrm/smap/internal/sitemap"
+)
+
+// sitemapSeeds reads sitemaps and gives the urls listed in them which
+// weren't found by crawling, they are added to the sitemap as orphans
+// at depth 0, the other ones are marked as listed in a sitemap
+func (s *Service) sitemapSeeds(ctx context.Context) []*url.URL {
+	sitemaps := append([]string(nil), s.c.sitemaps...)
+	announced := make([]string, 0, len(s.sm.Sitemaps))
+	for sm := range s.sm.Sitemaps {
+		announced = append(announced, sm)
+	}
+	sort.Strings(announced)
+	sitemaps = append(sitemaps, announced...)
+	if len(sitemaps) == 0 {
+		for _, u := range append([]*url.URL{s.root}, s.c.seeds...) {
+			sitemaps = append(sitemaps, u.ResolveReference(
+				&url.URL{Path: "/sitemap.xml"}).String())
+		}
+	}
+
+	var seeds []*url.URL
+	for _, raw := range s.c.loader.Load(ctx, sitemaps...) {
+		l, err := s.urlParse(s.root, raw)
+		if err != nil {
+			continue
+		}
+		link := l.String()
+		if s.sm.UpdateNode(link, func(n *sitemap.Node) {
+			n.InSitemap = true
+		}) {
+			continue
+		}
+		if !s.scope.InScope(l) || !s.filtered(l) || !s.allowed(ctx, l) {
+			continue
+		}
+		if s.c.debug {
+			s.log.Println("link:", link, "is only found in sitemap")
+		}
+		s.sm.AddURL(link, 0)
+		s.sm.UpdateNode(link, func(n *sitemap.Node) {
+			n.InSitemap = true
+			n.Orphan = true
+		})
+		seeds = append(seeds, l)
+	}
+	return seeds
+}
@@ -0,0 +1,91 @@
+package linkcheck
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/khrm/smap/internal/atomicfile"
+)
+
+// entry is a result kept in the cache along with the time of the check
+type entry struct {
+	Result
+	Checked time.Time
+}
+
+// Cache keeps results of checks in a file so that urls aren't
+// checked again before ttl is elapsed, i.e. by the next run
+type Cache struct {
+	file string
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+// NewCache gives a Cache kept in file, results loaded from it are the
+// ones checked less than ttl ago
+// A missing file gives an empty cache
+func NewCache(file string, ttl time.Duration) (*Cache, error) {
+	c := &Cache{file: file, ttl: ttl, entries: make(map[string]entry)}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, err
+	}
+	for u, e := range c.entries {
+		if c.expired(e) {
+			delete(c.entries, u)
+		}
+	}
+	return c, nil
+}
+
+func (c *Cache) expired(e entry) bool {
+	return time.Since(e.Checked) >= c.ttl
+}
+
+// Get gives the result of the check of u if it's still valid
+func (c *Cache) Get(u string) (*Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[u]
+	if !ok || c.expired(e) {
+		return nil, false
+	}
+	r := e.Result
+	return &r, true
+}
+
+// Put records r as the result of the check of u made now
+func (c *Cache) Put(u string, r *Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[u] = entry{Result: *r, Checked: time.Now()}
+}
+
+// Save writes the results still valid to the file of the cache,
+// the previous file is only replaced once it's fully written
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	for u, e := range c.entries {
+		if c.expired(e) {
+			delete(c.entries, u)
+		}
+	}
+	data, err := json.Marshal(c.entries)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(c.file, data)
+}
@@ -0,0 +1,83 @@
+package linkcheck
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache", "links.json")
+	c, err := NewCache(file, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("https://ok.io"); ok {
+		t.Error("Cache.Get() of empty cache gives a result")
+	}
+	c.Put("https://ok.io", &Result{Status: 200})
+	c.Put("https://old.io", &Result{Status: 404})
+	c.entries["https://old.io"] = entry{Result: Result{Status: 404},
+		Checked: time.Now().Add(-2 * time.Hour)}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := NewCache(file, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := loaded.Get("https://ok.io"); !ok ||
+		!reflect.DeepEqual(got, &Result{Status: 200}) {
+		t.Errorf("Cache.Get() = %+v, %v, want 200", got, ok)
+	}
+	if _, ok := loaded.Get("https://old.io"); ok {
+		t.Error("Cache.Get() gives an expired result")
+	}
+
+	expired, err := NewCache(file, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := expired.Get("https://ok.io"); ok {
+		t.Error("Cache.Get() gives a result older than ttl")
+	}
+}
+
+func TestChecker_CheckCached(t *testing.T) {
+	client := &fakeClient{
+		statuses: map[string]int{
+			"HEAD https://ok.io":   200,
+			"HEAD https://busy.io": 503,
+			"GET https://busy.io":  503,
+		},
+	}
+	cache, err := NewCache(filepath.Join(t.TempDir(), "links.json"),
+		time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(client, log.New(ioutil.Discard, "", 0), true).WithCache(cache)
+
+	for i := 0; i < 3; i++ {
+		for _, u := range []string{"https://ok.io", "https://busy.io",
+			"https://nxdomain.io"} {
+			c.Check(context.Background(), u)
+		}
+	}
+
+	want := []string{
+		"HEAD https://ok.io",
+		"HEAD https://busy.io", "GET https://busy.io",
+		"HEAD https://nxdomain.io", "GET https://nxdomain.io",
+		"HEAD https://busy.io", "GET https://busy.io",
+		"HEAD https://busy.io", "GET https://busy.io",
+	}
+	if !reflect.DeepEqual(client.requests, want) {
+		t.Errorf("requests = %v, want %v", client.requests, want)
+	}
+}
@@ -0,0 +1,123 @@
+// Package linkcheck tells whether urls can be got, it's used for
+// links which aren't crawled like the ones to other sites
+package linkcheck
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/khrm/smap/internal/redirect"
+	"github.com/khrm/smap/internal/retry"
+)
+
+// ErrTooManyRedirects is returned when more than redirect.DefaultMax
+// redirections would be followed
+var ErrTooManyRedirects = redirect.ErrTooMany
+
+// transportClient defines the interface needed to make requests
+type transportClient interface {
+	Do(req *http.Request) (resp *http.Response, err error)
+}
+
+// Result is the outcome of the check of a url
+type Result struct {
+	// Status is the status code of the final response
+	Status int `json:",omitempty"`
+	// Error is the reason no response was got, i.e. a dns failure
+	Error string `json:",omitempty"`
+}
+
+// Broken tells whether the url couldn't be got
+func (r *Result) Broken() bool {
+	return r.Error != "" || r.Status >= 400
+}
+
+// Checker checks urls with a HEAD request, then a GET one if it fails
+// as some servers don't answer HEAD requests properly
+type Checker struct {
+	client transportClient
+	log    *log.Logger
+	debug  bool
+	cache  *Cache
+}
+
+// New gives an instance of Checker
+func New(client transportClient, l *log.Logger, debug bool) *Checker {
+	return &Checker{client: client, log: l, debug: debug}
+}
+
+// WithCache makes the checker reuse the results of cache and record
+// its results in it, transient failures like timeouts or 503 aren't
+// recorded
+func (c *Checker) WithCache(cache *Cache) *Checker {
+	c.cache = cache
+	return c
+}
+
+// Check requests u and gives the outcome, redirections are followed
+func (c *Checker) Check(ctx context.Context, u string) *Result {
+	if c.cache != nil {
+		if r, ok := c.cache.Get(u); ok {
+			if c.debug {
+				c.log.Println("link:", u, "check is cached")
+			}
+			return r
+		}
+	}
+	r, err := c.check(ctx, u)
+	if c.cache != nil && ctx.Err() == nil && !transient(r, err) {
+		c.cache.Put(u, r)
+	}
+	return r
+}
+
+// transient tells whether check result r, failed with err, may be
+// different if it's made again soon, i.e. a timeout or a 503
+func transient(r *Result, err error) bool {
+	if err != nil {
+		return retry.Temporary(err)
+	}
+	for _, s := range retry.DefaultStatuses {
+		if s == r.Status {
+			return true
+		}
+	}
+	return false
+}
+
+// check requests u with HEAD then GET, it gives the error
+// which prevented to get a response along with the result
+func (c *Checker) check(ctx context.Context, u string) (*Result, error) {
+	status, err := c.request(ctx, http.MethodHead, u)
+	if err != nil || status >= 400 {
+		if ctx.Err() != nil {
+			return &Result{Error: ctx.Err().Error()}, ctx.Err()
+		}
+		if c.debug {
+			c.log.Printf("HEAD %s failed (%d, %v), trying GET", u, status,
+				err)
+		}
+		status, err = c.request(ctx, http.MethodGet, u)
+	}
+	if err != nil {
+		return &Result{Error: err.Error()}, err
+	}
+	return &Result{Status: status}, nil
+}
+
+// request makes a request to u with method and follows its
+// redirections, it gives the status of the final response
+func (c *Checker) request(ctx context.Context, method,
+	u string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	r, err := redirect.Do(c.client, req, redirect.Config{})
+	if err != nil {
+		return 0, err
+	}
+	r.Response.Body.Close()
+	return r.Response.StatusCode, nil
+}
@@ -0,0 +1,114 @@
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/khrm/smap/internal/redirect"
+)
+
+// fakeClient answers requests with the status of their method and url,
+// urls in redirects answer 301 to the url given
+type fakeClient struct {
+	statuses  map[string]int
+	redirects map[string]string
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func (f *fakeClient) Do(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req.Method+" "+req.URL.String())
+	f.mu.Unlock()
+
+	resp := &http.Response{
+		Request: req,
+		Header:  make(http.Header),
+		Body:    ioutil.NopCloser(strings.NewReader("")),
+	}
+	u := req.URL.String()
+	if loc, ok := f.redirects[u]; ok {
+		resp.StatusCode = http.StatusMovedPermanently
+		resp.Header.Set("Location", loc)
+		return resp, nil
+	}
+	status, ok := f.statuses[req.Method+" "+u]
+	if !ok {
+		return nil, errors.New("dial tcp: lookup " + req.URL.Host +
+			": no such host")
+	}
+	resp.StatusCode = status
+	return resp, nil
+}
+
+func TestChecker_Check(t *testing.T) {
+	client := &fakeClient{
+		statuses: map[string]int{
+			"HEAD https://ok.io":         200,
+			"HEAD https://nohead.io":     405,
+			"GET https://nohead.io":      200,
+			"HEAD https://missing.io/a":  404,
+			"GET https://missing.io/a":   404,
+			"HEAD https://moved.io/new":  200,
+			"HEAD https://moved.io/gone": 410,
+			"GET https://moved.io/gone":  410,
+		},
+		redirects: map[string]string{
+			"https://moved.io/old":    "/new",
+			"https://moved.io/broken": "https://moved.io/gone",
+			"https://loop.io/a":       "https://loop.io/b",
+			"https://loop.io/b":       "https://loop.io/a",
+		},
+	}
+	for i := 0; i <= redirect.DefaultMax; i++ {
+		client.redirects[fmt.Sprintf("https://chain.io/%d", i)] =
+			fmt.Sprintf("https://chain.io/%d", i+1)
+	}
+	c := New(client, log.New(ioutil.Discard, "", 0), true)
+
+	tests := []struct {
+		url        string
+		want       *Result
+		wantBroken bool
+	}{
+		{"https://ok.io", &Result{Status: 200}, false},
+		{"https://nohead.io", &Result{Status: 200}, false},
+		{"https://missing.io/a", &Result{Status: 404}, true},
+		{"https://moved.io/old", &Result{Status: 200}, false},
+		{"https://moved.io/broken", &Result{Status: 410}, true},
+		{"https://loop.io/a", &Result{
+			Error: redirect.ErrLoop.Error()}, true},
+		{"https://chain.io/0", &Result{
+			Error: ErrTooManyRedirects.Error()}, true},
+		{"https://nxdomain.io", &Result{
+			Error: "dial tcp: lookup nxdomain.io: no such host"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got := c.Check(context.Background(), tt.url)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Checker.Check() = %+v, want %+v", got, tt.want)
+			}
+			if got.Broken() != tt.wantBroken {
+				t.Errorf("Result.Broken() = %v, want %v", got.Broken(),
+					tt.wantBroken)
+			}
+		})
+	}
+
+	client.requests = nil
+	c.Check(context.Background(), "https://ok.io")
+	if want := []string{"HEAD https://ok.io"}; !reflect.DeepEqual(
+		client.requests, want) {
+		t.Errorf("requests = %v, want %v", client.requests, want)
+	}
+}
@@ -0,0 +1,341 @@
+package normalize
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Rule rewrites a url in place to its canonical form
+type Rule func(u *url.URL)
+
+// Names of the rules which can be selected with ByName
+// Rules are always applied in this order
+var Names = []string{
+	"fragment",
+	"lowercase",
+	"defaultport",
+	"idn",
+	"unescape",
+	"tracking",
+	"sortquery",
+	"index",
+	"noslash",
+	"slash",
+}
+
+// rules are the rules by name
+var rules = map[string]Rule{
+	"fragment":    DropFragment,
+	"lowercase":   LowercaseSchemeHost,
+	"defaultport": StripDefaultPort,
+	"idn":         PunycodeHost,
+	"unescape":    DecodeUnreserved,
+	"tracking":    DropTrackingParams,
+	"sortquery":   SortQuery,
+	"index":       CollapseIndex,
+	"noslash":     StripTrailingSlash,
+	"slash":       AddTrailingSlash,
+}
+
+// DefaultNames are the rules used when nothing is configured
+var DefaultNames = []string{"fragment", "lowercase", "defaultport",
+	"idn", "unescape", "noslash"}
+
+// Normalizer applies a list of rules on urls
+type Normalizer struct {
+	rules []Rule
+}
+
+// New gives a Normalizer applying rules in order
+func New(rules ...Rule) *Normalizer {
+	return &Normalizer{rules: rules}
+}
+
+// Default gives a Normalizer with DefaultNames rules
+func Default() *Normalizer {
+	n, _ := ByName(DefaultNames...)
+	return n
+}
+
+// ByName gives a Normalizer with the rules named, they are applied
+// in the order of Names whatever the order they are given in
+func ByName(names ...string) (*Normalizer, error) {
+	selected := make(map[string]bool, len(names))
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		if _, ok := rules[n]; !ok {
+			return nil, fmt.Errorf("unknown normalization rule %q", n)
+		}
+		selected[n] = true
+	}
+	if selected["slash"] && selected["noslash"] {
+		return nil, fmt.Errorf("rules slash and noslash are exclusive")
+	}
+
+	nz := &Normalizer{}
+	for _, n := range Names {
+		if selected[n] {
+			nz.rules = append(nz.rules, rules[n])
+		}
+	}
+	return nz, nil
+}
+
+// Normalize returns a normalized copy of u
+func (n *Normalizer) Normalize(u *url.URL) *url.URL {
+	c := *u
+	if u.User != nil {
+		user := *u.User
+		c.User = &user
+	}
+	for _, r := range n.rules {
+		r(&c)
+	}
+	return &c
+}
+
+// String normalizes a raw url
+func (n *Normalizer) String(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	return n.Normalize(u).String(), nil
+}
+
+// DropFragment removes the fragment, it's the same document
+func DropFragment(u *url.URL) {
+	u.Fragment = ""
+	u.RawFragment = ""
+}
+
+// LowercaseSchemeHost lowercases scheme and host, they are case
+// insensitive
+func LowercaseSchemeHost(u *url.URL) {
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+}
+
+// StripDefaultPort removes :80 from http and :443 from https urls
+func StripDefaultPort(u *url.URL) {
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return
+	}
+	if (u.Scheme == "http" && port == "80") ||
+		(u.Scheme == "https" && port == "443") {
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		u.Host = host
+	}
+}
+
+// PunycodeHost converts an internationalized host to its ascii form
+// the way browsers look it up, i.e. bücher.de becomes xn--bcher-kva.de
+// Hosts which aren't valid names are left as they are
+func PunycodeHost(u *url.URL) {
+	host, port := u.Host, ""
+	if h, p, err := net.SplitHostPort(u.Host); err == nil {
+		host, port = h, p
+	}
+	if isASCII(host) {
+		return
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return
+	}
+	u.Host = ascii
+	if port != "" {
+		u.Host += ":" + port
+	}
+}
+
+// DecodeUnreserved decodes percent escapes of unreserved characters
+// (letters, digits, -._~) in path and query, and uppercases other escapes
+func DecodeUnreserved(u *url.URL) {
+	p := decodeUnreserved(u.EscapedPath())
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		u.Path = unescaped
+		u.RawPath = p
+	}
+	u.RawQuery = decodeUnreserved(u.RawQuery)
+}
+
+// trackingParams are query parameters which don't change the document
+var trackingParams = map[string]struct{}{
+	"fbclid":       {},
+	"gclid":        {},
+	"dclid":        {},
+	"msclkid":      {},
+	"yclid":        {},
+	"igshid":       {},
+	"mc_cid":       {},
+	"mc_eid":       {},
+	"_ga":          {},
+	"jsessionid":   {},
+	"phpsessid":    {},
+	"aspsessionid": {},
+	"sessionid":    {},
+	"sid":          {},
+	"cfid":         {},
+	"cftoken":      {},
+}
+
+// DropTrackingParams removes utm_* parameters, click ids and
+// session ids from the query, and ;jsessionid= from the path
+func DropTrackingParams(u *url.URL) {
+	if i := strings.Index(strings.ToLower(u.Path), ";jsessionid="); i >= 0 {
+		u.Path = u.Path[:i]
+		u.RawPath = ""
+	}
+
+	if u.RawQuery == "" {
+		return
+	}
+	var kept []string
+	for _, p := range strings.Split(u.RawQuery, "&") {
+		k := p
+		if i := strings.Index(p, "="); i >= 0 {
+			k = p[:i]
+		}
+		if uk, err := url.QueryUnescape(k); err == nil {
+			k = uk
+		}
+		k = strings.ToLower(k)
+		if _, ok := trackingParams[k]; ok || strings.HasPrefix(k, "utm_") {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	if u.RawQuery == "" {
+		u.ForceQuery = false
+	}
+}
+
+// SortQuery sorts query parameters by name, parameters
+// having the same name keep their order
+func SortQuery(u *url.URL) {
+	if u.RawQuery == "" {
+		return
+	}
+	params := strings.Split(u.RawQuery, "&")
+	key := func(p string) string {
+		if i := strings.Index(p, "="); i >= 0 {
+			return p[:i]
+		}
+		return p
+	}
+	sort.SliceStable(params, func(i, j int) bool {
+		return key(params[i]) < key(params[j])
+	})
+	u.RawQuery = strings.Join(params, "&")
+}
+
+// indexFiles are the documents served for a directory
+var indexFiles = map[string]struct{}{
+	"index.html":   {},
+	"index.htm":    {},
+	"index.php":    {},
+	"default.htm":  {},
+	"default.html": {},
+	"default.aspx": {},
+}
+
+// CollapseIndex removes index files from the path, /docs/index.html
+// becomes /docs/
+func CollapseIndex(u *url.URL) {
+	dir, file := path.Split(u.Path)
+	if _, ok := indexFiles[strings.ToLower(file)]; !ok {
+		return
+	}
+	u.Path = dir
+	u.RawPath = ""
+}
+
+// StripTrailingSlash removes trailing / as url with and
+// without it are considered the same
+func StripTrailingSlash(u *url.URL) {
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = strings.TrimRight(u.RawPath, "/")
+}
+
+// AddTrailingSlash adds a trailing / to paths not naming a file,
+// i.e. /docs becomes /docs/ but /docs/a.pdf is unchanged
+func AddTrailingSlash(u *url.URL) {
+	if strings.HasSuffix(u.Path, "/") {
+		return
+	}
+	if strings.Contains(path.Base(u.Path), ".") {
+		return
+	}
+	u.Path += "/"
+	if u.RawPath != "" {
+		u.RawPath += "/"
+	}
+}
+
+// decodeUnreserved decodes escapes of unreserved characters in s
+func decodeUnreserved(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) ||
+			!isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString(strings.ToUpper(s[i : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' ||
+		c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' ||
+		'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
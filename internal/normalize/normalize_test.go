@@ -0,0 +1,68 @@
+package normalize
+
+import (
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		url  string
+		want string
+	}{
+		{"fragment", DropFragment, "https://a.io/x#top", "https://a.io/x"},
+		{"lowercase", LowercaseSchemeHost, "HTTPS://A.IO/Docs", "https://a.io/Docs"},
+		{"default port https", StripDefaultPort, "https://a.io:443/", "https://a.io/"},
+		{"default port http", StripDefaultPort, "http://a.io:80/", "http://a.io/"},
+		{"other port", StripDefaultPort, "https://a.io:8443/", "https://a.io:8443/"},
+		{"ipv6 port", StripDefaultPort, "http://[::1]:80/", "http://[::1]/"},
+		{"idn", PunycodeHost, "https://bücher.de/", "https://xn--bcher-kva.de/"},
+		{"idn port", PunycodeHost, "https://münchen.de:8080/", "https://xn--mnchen-3ya.de:8080/"},
+		{"idn cjk", PunycodeHost, "https://例え.jp/", "https://xn--r8jz45g.jp/"},
+		{"idn mixed case", PunycodeHost, "https://BÜCHER.de/", "https://xn--bcher-kva.de/"},
+		{"idn compatibility", PunycodeHost, "https://ｂüｃｈｅｒ.de/", "https://xn--bcher-kva.de/"},
+		{"idn invalid", PunycodeHost, "https://ü_ö.de/", "https://%C3%BC_%C3%B6.de/"},
+		{"unescape", DecodeUnreserved, "https://a.io/%7euser/a%2fb?q=%41%2f", "https://a.io/~user/a%2Fb?q=A%2F"},
+		{"tracking", DropTrackingParams, "https://a.io/?utm_source=x&id=1&fbclid=y&UTM_medium=z", "https://a.io/?id=1"},
+		{"tracking only", DropTrackingParams, "https://a.io/?gclid=1", "https://a.io/"},
+		{"jsessionid", DropTrackingParams, "https://a.io/x;jsessionid=ABC", "https://a.io/x"},
+		{"sort query", SortQuery, "https://a.io/?b=2&a=1&b=1", "https://a.io/?a=1&b=2&b=1"},
+		{"index", CollapseIndex, "https://a.io/docs/index.html", "https://a.io/docs/"},
+		{"index other", CollapseIndex, "https://a.io/docs/indexes.html", "https://a.io/docs/indexes.html"},
+		{"no slash", StripTrailingSlash, "https://a.io/docs/", "https://a.io/docs"},
+		{"slash", AddTrailingSlash, "https://a.io/docs", "https://a.io/docs/"},
+		{"slash file", AddTrailingSlash, "https://a.io/a.pdf", "https://a.io/a.pdf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.rule).String(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%s) = %s, want %s", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestByName(t *testing.T) {
+	n, err := ByName("noslash", "index", "sortquery", "tracking",
+		"lowercase", "defaultport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := n.String("HTTP://Ex.io:80/Docs/index.html?z=1&utm_id=2&a=3")
+	want := "http://ex.io/Docs?a=3&z=1"
+	if got != want {
+		t.Errorf("Normalize() = %s, want %s", got, want)
+	}
+
+	if _, err := ByName("unknown"); err == nil {
+		t.Errorf("ByName() error = nil, want error")
+	}
+	if _, err := ByName("slash", "noslash"); err == nil {
+		t.Errorf("ByName() error = nil, want error")
+	}
+}
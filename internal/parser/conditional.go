@@ -0,0 +1,25 @@
+package parser
+
+import (
+	"net/http"
+)
+
+// Validators are the ETag and Last-Modified got for a url, they make
+// its request conditional so that it answers 304 if it's unchanged
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// setConditions adds the conditional headers of v to req
+func setConditions(req *http.Request, v *Validators) {
+	if v == nil {
+		return
+	}
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+}
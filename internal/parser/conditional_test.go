@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// conditionalClient answers 304 to requests matching its validators
+type conditionalClient Validators
+
+func (c conditionalClient) Do(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{
+		Request: req,
+		Header:  make(http.Header),
+		Body:    ioutil.NopCloser(strings.NewReader(HTMLData)),
+	}
+	if (c.ETag != "" && req.Header.Get("If-None-Match") == c.ETag) ||
+		(c.LastModified != "" &&
+			req.Header.Get("If-Modified-Since") == c.LastModified) {
+		resp.StatusCode = http.StatusNotModified
+		return resp, nil
+	}
+	resp.StatusCode = http.StatusOK
+	resp.Header.Set("Content-Type", "text/html")
+	resp.Header.Set("ETag", c.ETag)
+	return resp, nil
+}
+
+func Test_parser_ExtractURLsConditional(t *testing.T) {
+	const lastModified = "Wed, 21 Oct 2015 07:28:00 GMT"
+	tests := []struct {
+		name       string
+		client     conditionalClient
+		validators *Validators
+		wantStatus int
+	}{
+		{"unconditional", conditionalClient{ETag: `"a"`}, nil, 200},
+		{"etag match", conditionalClient{ETag: `"a"`},
+			&Validators{ETag: `"a"`}, 304},
+		{"etag changed", conditionalClient{ETag: `"b"`},
+			&Validators{ETag: `"a"`}, 200},
+		{"not modified since", conditionalClient{
+			LastModified: lastModified},
+			&Validators{LastModified: lastModified}, 304},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.client, log.New(ioutil.Discard, "", 0), false, 1)
+			got, err := p.ExtractURLs(context.Background(), "https://a.io",
+				Options{Validators: tt.validators})
+			if err != nil {
+				t.Fatalf("parser.ExtractURLs() error = %v", err)
+			}
+			if got.Fetch.Status != tt.wantStatus {
+				t.Errorf("parser.ExtractURLs() Status = %d, want %d",
+					got.Fetch.Status, tt.wantStatus)
+			}
+			if tt.wantStatus == 304 && len(got.Links) > 0 {
+				t.Errorf("parser.ExtractURLs() Links = %v on 304",
+					got.Links)
+			}
+			if tt.wantStatus == 200 && len(got.Links) == 0 {
+				t.Error("parser.ExtractURLs() gives no links on 200")
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"net/http"
+	"strings"
+)
+
+// valuedDirectives are the robots directives written as name: value,
+// other names followed by a colon are user agents
+var valuedDirectives = map[string]struct{}{
+	"unavailable_after": {},
+	"max-snippet":       {},
+	"max-image-preview": {},
+	"max-video-preview": {},
+}
+
+// robotsDirectives reads the noindex and nofollow directives
+// of a robots meta element or a X-Robots-Tag header
+// Directives given for a specific user agent, i.e. googlebot: noindex,
+// are ignored
+func robotsDirectives(v string) (noindex, nofollow bool) {
+	agent := ""
+	for _, d := range strings.Split(v, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if i := strings.Index(d, ":"); i >= 0 {
+			name := strings.TrimSpace(d[:i])
+			if _, ok := valuedDirectives[name]; !ok {
+				agent = name
+				d = strings.TrimSpace(d[i+1:])
+			}
+		}
+		if agent != "" {
+			continue
+		}
+		switch d {
+		case "noindex":
+			noindex = true
+		case "nofollow":
+			nofollow = true
+		case "none":
+			noindex, nofollow = true, true
+		}
+	}
+	return noindex, nofollow
+}
+
+// setDirectives adds the directives of a robots meta element
+// or a X-Robots-Tag header to page
+func (page *Page) setDirectives(v string) {
+	noindex, nofollow := robotsDirectives(v)
+	page.NoIndex = page.NoIndex || noindex
+	page.NoFollow = page.NoFollow || nofollow
+}
+
+// setHeaderDirectives adds the directives of the X-Robots-Tag headers
+// of h to page, every header is read on its own as a user agent
+// prefix only applies to the header it's written in
+func (page *Page) setHeaderDirectives(h http.Header) {
+	for _, v := range h.Values("X-Robots-Tag") {
+		page.setDirectives(v)
+	}
+}
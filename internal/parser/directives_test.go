@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func Test_robotsDirectives(t *testing.T) {
+	tests := []struct {
+		v            string
+		wantNoindex  bool
+		wantNofollow bool
+	}{
+		{"", false, false},
+		{"index, follow", false, false},
+		{"NOINDEX", true, false},
+		{"noindex,nofollow", true, true},
+		{"none", true, true},
+		{"unavailable_after: 25 Jun 2010 15:00:00 PST, nofollow", false,
+			true},
+		{"googlebot: noindex, nofollow", false, false},
+		{"noarchive, otherbot: noindex", false, false},
+	}
+	for _, tt := range tests {
+		noindex, nofollow := robotsDirectives(tt.v)
+		if noindex != tt.wantNoindex || nofollow != tt.wantNofollow {
+			t.Errorf("robotsDirectives(%q) = %v, %v, want %v, %v", tt.v,
+				noindex, nofollow, tt.wantNoindex, tt.wantNofollow)
+		}
+	}
+}
+
+func Test_parser_parseBodyDirectives(t *testing.T) {
+	p := &parser{}
+	page := p.parseBody(ioutil.NopCloser(bytes.NewReader([]byte(`
+<html><head>
+<link rel="canonical" href="/docs/">
+<link rel="canonical" href="/ignored">
+<meta name="Robots" content="noindex">
+<meta name="googlebot" content="nofollow">
+</head></html>`))))
+	if page.Canonical != "/docs/" {
+		t.Errorf("parser.parseBody() Canonical = %q, want /docs/",
+			page.Canonical)
+	}
+	if !page.NoIndex || page.NoFollow {
+		t.Errorf("parser.parseBody() NoIndex, NoFollow = %v, %v, want"+
+			" true, false", page.NoIndex, page.NoFollow)
+	}
+
+	page.setDirectives("nofollow")
+	if !page.NoIndex || !page.NoFollow {
+		t.Errorf("Page.setDirectives() NoIndex, NoFollow = %v, %v, want"+
+			" true, true", page.NoIndex, page.NoFollow)
+	}
+}
+
+func TestPage_setHeaderDirectives(t *testing.T) {
+	tests := []struct {
+		name         string
+		values       []string
+		wantNoindex  bool
+		wantNofollow bool
+	}{
+		{"none", nil, false, false},
+		{"agent then generic", []string{"googlebot: nofollow", "noindex"},
+			true, false},
+		{"generic then agent", []string{"nofollow", "otherbot: noindex"},
+			false, true},
+		{"both generic", []string{"noindex", "nofollow"}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{"X-Robots-Tag": tt.values}
+			page := &Page{}
+			page.setHeaderDirectives(h)
+			if page.NoIndex != tt.wantNoindex ||
+				page.NoFollow != tt.wantNofollow {
+				t.Errorf("Page.setHeaderDirectives(%q) NoIndex, NoFollow ="+
+					" %v, %v, want %v, %v", tt.values, page.NoIndex,
+					page.NoFollow, tt.wantNoindex, tt.wantNofollow)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Fetch contains the details of the response got for a url
+type Fetch struct {
+	// Status is the status code of the final response
+	Status int
+	// Redirects are the hops followed before the final response
+	Redirects []Redirect `json:",omitempty"`
+	// FinalURL is the url of the final response if it was redirected,
+	// or the target which wasn't requested on a loop or a target not
+	// allowed
+	FinalURL string `json:",omitempty"`
+	// Loop is set when redirections lead back to a url of the chain
+	Loop          bool   `json:",omitempty"`
+	ContentType   string `json:",omitempty"`
+	ContentLength int64
+	ResponseTime  Duration
+	LastModified  string `json:",omitempty"`
+	ETag          string `json:",omitempty"`
+	// RobotsTag are the values of the X-Robots-Tag headers
+	RobotsTag string `json:",omitempty"`
+	// NotModified is set when the url answered 304 to a conditional
+	// request, the other details are then the ones of the previous crawl
+	NotModified bool `json:",omitempty"`
+}
+
+// Redirect is a url which answered with a redirection
+type Redirect struct {
+	URL    string
+	Status int
+}
+
+// Duration is a time.Duration written as "1.5s" in json
+type Duration time.Duration
+
+// MarshalJSON writes d as a string like 150ms
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON reads a duration written by MarshalJSON
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// newFetch gives the details of resp which took elapsed to come
+func newFetch(resp *http.Response, elapsed time.Duration) Fetch {
+	return Fetch{
+		Status:        resp.StatusCode,
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: resp.ContentLength,
+		ResponseTime:  Duration(elapsed),
+		LastModified:  resp.Header.Get("Last-Modified"),
+		ETag:          resp.Header.Get("ETag"),
+		RobotsTag:     strings.Join(resp.Header.Values("X-Robots-Tag"), ", "),
+	}
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
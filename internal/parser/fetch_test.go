@@ -0,0 +1,184 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khrm/smap/internal/redirect"
+)
+
+func Test_newFetch(t *testing.T) {
+	resp := &http.Response{
+		StatusCode:    200,
+		ContentLength: 42,
+		Header: http.Header{
+			"Content-Type":  {"text/html"},
+			"Last-Modified": {"Wed, 21 Oct 2015 07:28:00 GMT"},
+			"Etag":          {`"abc"`},
+			"X-Robots-Tag":  {"noarchive", "googlebot: noindex"},
+		},
+	}
+
+	want := Fetch{
+		Status:        200,
+		ContentType:   "text/html",
+		ContentLength: 42,
+		ResponseTime:  Duration(time.Second),
+		LastModified:  "Wed, 21 Oct 2015 07:28:00 GMT",
+		ETag:          `"abc"`,
+		RobotsTag:     "noarchive, googlebot: noindex",
+	}
+	if got := newFetch(resp, time.Second); !reflect.DeepEqual(got, want) {
+		t.Errorf("newFetch() = %+v, want %+v", got, want)
+	}
+}
+
+// redirectClient answers with the redirections of locations,
+// urls not in it give an html page
+type redirectClient map[string]string
+
+func (r redirectClient) Do(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{
+		Request: req,
+		Header:  make(http.Header),
+		Body:    ioutil.NopCloser(strings.NewReader(HTMLData)),
+	}
+	if loc, ok := r[req.URL.String()]; ok {
+		resp.StatusCode = http.StatusMovedPermanently
+		resp.Header.Set("Location", loc)
+		return resp, nil
+	}
+	resp.StatusCode = http.StatusOK
+	resp.ContentLength = -1
+	resp.Header.Set("Content-Type", "text/html")
+	return resp, nil
+}
+
+func Test_parser_ExtractURLsRedirects(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  redirectClient
+		allow   func(u *url.URL) bool
+		want    Fetch
+		wantErr error
+	}{
+		{
+			name: "chain",
+			client: redirectClient{
+				"http://a.io/old":  "https://a.io/old",
+				"https://a.io/old": "/new",
+			},
+			want: Fetch{
+				Status: 200,
+				Redirects: []Redirect{
+					{URL: "http://a.io/old", Status: 301},
+					{URL: "https://a.io/old", Status: 301},
+				},
+				FinalURL:      "https://a.io/new",
+				ContentType:   "text/html",
+				ContentLength: int64(len(HTMLData)),
+			},
+		},
+		{
+			name: "loop",
+			client: redirectClient{
+				"http://a.io/old": "http://a.io/b",
+				"http://a.io/b":   "http://a.io/old",
+			},
+			want: Fetch{
+				Status: 301,
+				Redirects: []Redirect{
+					{URL: "http://a.io/old", Status: 301},
+					{URL: "http://a.io/b", Status: 301},
+				},
+				FinalURL: "http://a.io/old",
+				Loop:     true,
+			},
+			wantErr: ErrRedirectLoop,
+		},
+		{
+			name: "not allowed",
+			client: redirectClient{
+				"http://a.io/old":       "http://a.io/b",
+				"http://a.io/b":         "/private/c",
+				"http://a.io/private/c": "/d",
+			},
+			allow: func(u *url.URL) bool {
+				return !strings.HasPrefix(u.Path, "/private")
+			},
+			want: Fetch{
+				Status: 301,
+				Redirects: []Redirect{
+					{URL: "http://a.io/old", Status: 301},
+					{URL: "http://a.io/b", Status: 301},
+				},
+				FinalURL: "http://a.io/private/c",
+			},
+			wantErr: ErrRedirectNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.client, log.New(ioutil.Discard, "", 0), false, 1)
+			got, err := p.ExtractURLs(context.Background(),
+				"http://a.io/old", Options{Allow: tt.allow})
+			if err != tt.wantErr {
+				t.Fatalf("parser.ExtractURLs() error = %v, want %v", err,
+					tt.wantErr)
+			}
+			got.Fetch.ResponseTime = 0
+			if !reflect.DeepEqual(got.Fetch, tt.want) {
+				t.Errorf("parser.ExtractURLs() Fetch = %+v, want %+v",
+					got.Fetch, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parser_ExtractURLsTooManyRedirects(t *testing.T) {
+	client := redirectClient{}
+	for i := 0; i < redirect.DefaultMax+1; i++ {
+		client[fmt.Sprintf("http://a.io/%d", i)] =
+			fmt.Sprintf("http://a.io/%d", i+1)
+	}
+	p := New(client, log.New(ioutil.Discard, "", 0), false, 1)
+	got, err := p.ExtractURLs(context.Background(), "http://a.io/0",
+		Options{})
+	if err != ErrTooManyRedirects {
+		t.Fatalf("parser.ExtractURLs() error = %v, want %v", err,
+			ErrTooManyRedirects)
+	}
+	// The last redirection, which isn't followed, is recorded too
+	if len(got.Fetch.Redirects) != redirect.DefaultMax+1 {
+		t.Errorf("redirects = %d, want %d", len(got.Fetch.Redirects),
+			redirect.DefaultMax+1)
+	}
+}
+
+func TestDuration_JSON(t *testing.T) {
+	d := Duration(1500 * time.Millisecond)
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `"1.5s"` {
+		t.Errorf("json.Marshal() = %s, want %s", b, `"1.5s"`)
+	}
+
+	var got Duration
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != d {
+		t.Errorf("json.Unmarshal() = %v, want %v", got, d)
+	}
+}
@@ -0,0 +1,175 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Image is an image shown in a page
+type Image struct {
+	URL string
+	// Alt is the alternative text of the img element
+	Alt string `json:",omitempty"`
+}
+
+// Video is a video embedded in a page, either with a video element
+// or declared with OpenGraph metas
+type Video struct {
+	// ContentURL is the url of the video file
+	ContentURL string `json:",omitempty"`
+	// PlayerURL is the url of a player for the video
+	PlayerURL    string `json:",omitempty"`
+	ThumbnailURL string `json:",omitempty"`
+	Title        string `json:",omitempty"`
+	Description  string `json:",omitempty"`
+	// Duration is the length of the video in seconds, 0 if unknown
+	Duration int `json:",omitempty"`
+}
+
+// News are the details of a page published as a news article
+type News struct {
+	// Publication is the name of the site publishing the article
+	Publication string
+	// Language is the ISO 639 code of the article language
+	Language string
+	// Published is the publication date as written in the page
+	Published string
+	Title     string
+}
+
+// media collects what's needed to build images, videos and news
+// of a page while walking its elements
+type media struct {
+	lang        string
+	title       string
+	description string
+	// og are the OpenGraph and article metas by property
+	og      map[string]string
+	images  []Image
+	videos  []Video
+	inVideo bool
+}
+
+// meta records a meta element
+func (m *media) meta(attrs map[string]string) {
+	if strings.EqualFold(attrs["name"], "description") &&
+		m.description == "" {
+		m.description = attrs["content"]
+	}
+	p := strings.ToLower(attrs["property"])
+	if !strings.HasPrefix(p, "og:") && !strings.HasPrefix(p, "article:") {
+		return
+	}
+	if m.og == nil {
+		m.og = map[string]string{}
+	}
+	if _, ok := m.og[p]; !ok {
+		m.og[p] = attrs["content"]
+	}
+}
+
+// element records img, video and source elements
+func (m *media) element(tag string, attrs map[string]string) {
+	switch tag {
+	case "html":
+		m.lang = attrs["lang"]
+	case "img":
+		if attrs["src"] != "" {
+			m.images = append(m.images, Image{URL: attrs["src"],
+				Alt: attrs["alt"]})
+		}
+	case "video":
+		m.videos = append(m.videos, Video{ContentURL: attrs["src"],
+			ThumbnailURL: attrs["poster"], Title: attrs["title"]})
+		m.inVideo = true
+	case "source":
+		v := len(m.videos) - 1
+		if m.inVideo && m.videos[v].ContentURL == "" {
+			m.videos[v].ContentURL = attrs["src"]
+		}
+	}
+}
+
+// end records the end of an element
+func (m *media) end(tag string) {
+	if tag == "video" {
+		m.inVideo = false
+	}
+}
+
+// fill sets images, videos and news of page, videos missing
+// a title, a description or a thumbnail get the ones of the page
+func (m *media) fill(page *Page) {
+	page.Images = m.images
+
+	videos := m.videos
+	if u := m.ogVideoURL(); u != "" {
+		v := Video{Title: m.og["og:title"],
+			Description: m.og["og:description"]}
+		if strings.HasPrefix(m.og["og:video:type"], "text/html") {
+			v.PlayerURL = u
+		} else {
+			v.ContentURL = u
+		}
+		if d, err := strconv.Atoi(m.og["og:video:duration"]); err == nil {
+			v.Duration = d
+		}
+		videos = append(videos, v)
+	}
+	for _, v := range videos {
+		if v.ContentURL == "" && v.PlayerURL == "" {
+			continue
+		}
+		if v.Title == "" {
+			v.Title = m.pageTitle()
+		}
+		if v.Description == "" {
+			v.Description = firstOf(m.og["og:description"],
+				m.description, v.Title)
+		}
+		if v.ThumbnailURL == "" {
+			v.ThumbnailURL = m.og["og:image"]
+		}
+		page.Videos = append(page.Videos, v)
+	}
+
+	if p := m.og["article:published_time"]; p != "" {
+		page.News = &News{
+			Publication: m.og["og:site_name"],
+			Language:    newsLanguage(m.lang),
+			Published:   p,
+			Title:       m.pageTitle(),
+		}
+	}
+}
+
+// ogVideoURL gives the url of the OpenGraph video
+func (m *media) ogVideoURL() string {
+	return firstOf(m.og["og:video:secure_url"], m.og["og:video:url"],
+		m.og["og:video"])
+}
+
+// pageTitle gives the OpenGraph title or else the title element
+func (m *media) pageTitle() string {
+	return firstOf(m.og["og:title"], m.title)
+}
+
+// newsLanguage gives the language code expected by news sitemaps
+// from a lang attribute, i.e. en-US gives en, regions are kept
+// only for chinese: zh-cn and zh-tw
+func newsLanguage(lang string) string {
+	lang = strings.ToLower(strings.Replace(lang, "_", "-", -1))
+	if strings.HasPrefix(lang, "zh-") {
+		return lang
+	}
+	return strings.SplitN(lang, "-", 2)[0]
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
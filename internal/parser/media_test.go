@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func Test_parser_parseBodyMedia(t *testing.T) {
+	p := &parser{}
+	got := p.parseBody(ioutil.NopCloser(bytes.NewReader([]byte(HTMLMedia))))
+
+	if got.Title != "Harbor & friends" {
+		t.Errorf("parser.parseBody() Title = %q, want %q", got.Title,
+			"Harbor & friends")
+	}
+
+	images := []Image{{URL: "/logo.png", Alt: "Harbor logo"},
+		{URL: "/diagram.svg"}}
+	if !reflect.DeepEqual(got.Images, images) {
+		t.Errorf("parser.parseBody() Images = %v, want %v", got.Images,
+			images)
+	}
+
+	videos := []Video{
+		{ContentURL: "/demo.mp4", ThumbnailURL: "/demo.jpg",
+			Title: "Harbor release", Description: "All about the release"},
+		{PlayerURL: "https://player.ex.io/embed/1",
+			ThumbnailURL: "https://ex.io/og.png", Title: "Harbor release",
+			Description: "All about the release", Duration: 95},
+	}
+	if !reflect.DeepEqual(got.Videos, videos) {
+		t.Errorf("parser.parseBody() Videos = %v, want %v", got.Videos,
+			videos)
+	}
+
+	news := &News{Publication: "Harbor blog", Language: "en",
+		Published: "2018-08-07T10:00:00+02:00", Title: "Harbor release"}
+	if !reflect.DeepEqual(got.News, news) {
+		t.Errorf("parser.parseBody() News = %v, want %v", got.News, news)
+	}
+}
+
+func Test_newsLanguage(t *testing.T) {
+	tests := []struct {
+		lang string
+		want string
+	}{
+		{"en-US", "en"},
+		{"FR", "fr"},
+		{"zh-TW", "zh-tw"},
+		{"zh_CN", "zh-cn"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := newsLanguage(tt.lang); got != tt.want {
+			t.Errorf("newsLanguage(%q) = %q, want %q", tt.lang, got,
+				tt.want)
+		}
+	}
+}
+
+var HTMLMedia = `
+<html lang="en-US">
+<head>
+<title> Harbor &amp; friends </title>
+<meta name="description" content="All about the release">
+<meta property="og:title" content="Harbor release">
+<meta property="og:site_name" content="Harbor blog">
+<meta property="og:image" content="https://ex.io/og.png">
+<meta property="og:video" content="https://player.ex.io/embed/1">
+<meta property="og:video:type" content="text/html">
+<meta property="og:video:duration" content="95">
+<meta property="article:published_time" content="2018-08-07T10:00:00+02:00">
+</head>
+<body>
+<img src="/logo.png" alt="Harbor logo">
+<img srcset="/only-srcset.png 1x">
+<img src="/diagram.svg">
+<video poster="/demo.jpg" controls>
+<source src="/demo.mp4" type="video/mp4">
+<source src="/demo.webm" type="video/webm">
+</video>
+<video></video>
+<svg><title>ignored</title></svg>
+</body>
+</html>
+`
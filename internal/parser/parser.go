@@ -1,13 +1,17 @@
 package parser
 
 import (
+	"context"
 	"errors"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 
+	"github.com/khrm/smap/internal/redirect"
 	"golang.org/x/net/html"
 )
 
@@ -15,17 +19,102 @@ var (
 	errInvalidContentTypeHeader = errors.New("unsupported content" +
 		" type header for crawling")
 	errLink404 = errors.New("url gives 404")
+	// ErrRedirectLoop is returned when a redirection leads
+	// to a url already in the redirect chain
+	ErrRedirectLoop = redirect.ErrLoop
+	// ErrTooManyRedirects is returned when more than
+	// redirect.DefaultMax redirections would be followed
+	ErrTooManyRedirects = redirect.ErrTooMany
+	// ErrRedirectNotAllowed is returned when a redirection leads
+	// to a url refused by Options.Allow
+	ErrRedirectNotAllowed = redirect.ErrNotAllowed
 )
 
 // transportClient defines the interface needed to get content from url
 type transportClient interface {
-	Get(url string) (resp *http.Response, err error)
+	Do(req *http.Request) (resp *http.Response, err error)
+}
+
+// waiter is a client which may hold requests to a host back, i.e.
+// to space them out, ExtractURLs waits for it before taking a slot so
+// that a host held back doesn't keep other hosts from being crawled
+type waiter interface {
+	Wait(ctx context.Context, host string) error
 }
 
 // ServiceParse is the interface which satisfy the service of extracting
 // URLS from HTML
 type ServiceParse interface {
-	ExtractURLs(url string) ([]string, error)
+	ExtractURLs(ctx context.Context, url string, o Options) (*Page, error)
+}
+
+// Options are the settings of a request made by ExtractURLs
+type Options struct {
+	// Allow tells whether a redirection target may be requested,
+	// redirections to targets it refuses aren't followed
+	Allow func(u *url.URL) bool
+	// Validators make the request conditional, they are the ones
+	// of the url requested so redirections are requested without them
+	Validators *Validators
+}
+
+// allows tells whether the redirection target u may be requested
+func (o Options) allows(u *url.URL) bool {
+	return o.Allow == nil || o.Allow(u)
+}
+
+// Page contains what was found in a html document
+type Page struct {
+	// Base is the href of the first base element, empty if there is none
+	// Relative links must be resolved against it
+	Base  string
+	Links []Link
+	// Title is the text of the title element
+	Title string `json:",omitempty"`
+	// Modified is the last modification date declared in a meta
+	// element, i.e. article:modified_time, as written in the page
+	Modified string
+	// Anchors are the ids of the elements of the page along with the
+	// names of its a elements, they are the targets of fragments
+	Anchors []string `json:",omitempty"`
+	// Canonical is the href of the first canonical link element
+	Canonical string `json:",omitempty"`
+	// NoIndex and NoFollow are the robots directives of the page,
+	// given by a robots meta element or a X-Robots-Tag header
+	NoIndex  bool `json:",omitempty"`
+	NoFollow bool `json:",omitempty"`
+	// Images, Videos and News are the media found in the page
+	Images []Image `json:",omitempty"`
+	Videos []Video `json:",omitempty"`
+	News   *News   `json:",omitempty"`
+	// Fetch are the details of the response
+	Fetch Fetch
+}
+
+// modifiedMetas are the meta names or properties giving the
+// last modification date of a page
+var modifiedMetas = map[string]struct{}{
+	"article:modified_time": {},
+	"og:updated_time":       {},
+	"last-modified":         {},
+	"dcterms.modified":      {},
+	"datemodified":          {},
+}
+
+// Link is a url found in a document along with the element
+// and the attribute it came from, i.e. img and srcset
+type Link struct {
+	URL  string
+	Tag  string
+	Attr string
+	// Rel is the rel attribute of a and link elements
+	Rel string `json:",omitempty"`
+	// Hreflang is the language of an alternate link element,
+	// it's only set for rel="alternate" hreflang annotations
+	Hreflang string `json:",omitempty"`
+	// Text is the anchor text of a elements, alt texts of their
+	// images included
+	Text string `json:",omitempty"`
 }
 
 type parser struct {
@@ -50,7 +139,20 @@ func New(client transportClient, l *log.Logger, debug bool,
 
 // ExtractURLs make request to url and fetch response
 // response is used to get links if it is html
-func (p *parser) ExtractURLs(url string) ([]string, error) {
+// Request is aborted when ctx is cancelled
+// Once a response is received, the page is returned with its details
+// even along with an error, i.e. for 404 or a non html document
+// Redirections are followed here and not by client, so that every hop
+// is recorded in the page details
+// Redirections to targets o doesn't allow aren't followed
+// The request is conditional if o has validators, the page is
+// returned without links if it answers 304
+func (p *parser) ExtractURLs(ctx context.Context, url string,
+	o Options) (*Page, error) {
+	if err := p.wait(ctx, url); err != nil {
+		return nil, err
+	}
+
 	p.cond.L.Lock()
 	for p.concurrent == 0 {
 		p.cond.Wait()
@@ -59,29 +161,106 @@ func (p *parser) ExtractURLs(url string) ([]string, error) {
 	p.cond.L.Unlock()
 	defer p.finished()
 
-	resp, err := p.client.Get(url)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	resp, fetch, err := p.get(ctx, url, o)
 	if err != nil {
 		if p.debug {
 			p.log.Printf("Error :%s encountered crawling link: %s",
 				err, url)
 		}
+		if fetch != nil {
+			return &Page{Fetch: *fetch}, err
+		}
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		if p.debug {
+			p.log.Printf("URL %s isn't modified", url)
+		}
+		return &Page{Fetch: *fetch}, nil
+	}
+
 	if resp.StatusCode == http.StatusNotFound {
 		if p.debug {
 			p.log.Printf("URL %s gives 404", url)
 		}
-		return nil, errLink404
+		return &Page{Fetch: *fetch}, errLink404
 	}
 
 	h := resp.Header.Get("Content-Type")
 	if !strings.HasPrefix(h, "text/html") {
-		return nil, errInvalidContentTypeHeader
+		page := &Page{Fetch: *fetch}
+		page.setHeaderDirectives(resp.Header)
+		return page, errInvalidContentTypeHeader
 	}
 
-	return p.linksInBody(resp.Body), nil
+	body := &countingReader{r: resp.Body}
+	page := p.parseBody(ioutil.NopCloser(body))
+	if fetch.ContentLength < 0 {
+		fetch.ContentLength = body.n
+	}
+	page.Fetch = *fetch
+	page.setHeaderDirectives(resp.Header)
+	return page, nil
+}
+
+// get requests link and follows its redirections allowed by o
+// It returns the final response and its details, or the details of
+// the redirections followed if it stopped on a loop, too many of them
+// or a target not allowed
+func (p *parser) get(ctx context.Context, link string,
+	o Options) (*http.Response, *Fetch, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	setConditions(req, o.Validators)
+
+	// Conditional headers aren't sent to redirection targets
+	r, err := redirect.Do(p.client, req, redirect.Config{Allow: o.Allow})
+	if r == nil {
+		return nil, nil, err
+	}
+	var hops []Redirect
+	for _, h := range r.Hops {
+		hops = append(hops, Redirect{URL: h.URL, Status: h.Status})
+	}
+	if err != nil {
+		fetch := &Fetch{Status: r.Response.StatusCode, Redirects: hops,
+			FinalURL: r.Next.String(), ResponseTime: Duration(r.Elapsed),
+			Loop: err == redirect.ErrLoop}
+		if err == redirect.ErrTooMany {
+			// Chain is cut, its end isn't known
+			fetch.FinalURL = ""
+		}
+		return nil, fetch, err
+	}
+
+	fetch := newFetch(r.Response, r.Elapsed)
+	if len(hops) > 0 {
+		fetch.Redirects = hops
+		fetch.FinalURL = r.URL.String()
+	}
+	return r.Response, &fetch, nil
+}
+
+// wait waits for the client to allow a request to the host of link
+func (p *parser) wait(ctx context.Context, link string) error {
+	w, ok := p.client.(waiter)
+	if !ok {
+		return nil
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		// The request fails on its own
+		return nil
+	}
+	return w.Wait(ctx, u.Host)
 }
 
 // finished locks the parser and increment the counter
@@ -94,25 +273,217 @@ func (p *parser) finished() {
 
 }
 
-// linksInBody get all links present in a html document
-func (p *parser) linksInBody(body io.ReadCloser) []string {
+// linkAttrs are the attributes holding urls for each element
+var linkAttrs = map[string][]string{
+	"a":      {"href"},
+	"area":   {"href"},
+	"link":   {"href"},
+	"iframe": {"src"},
+	"frame":  {"src"},
+	"form":   {"action"},
+	"img":    {"src", "srcset"},
+	"script": {"src"},
+	"source": {"src", "srcset"},
+}
+
+// parseBody get all links present in a html document along
+// with its base url and its media
+func (p *parser) parseBody(body io.ReadCloser) *Page {
 	t := html.NewTokenizer(body)
 
-	urls := []string{}
+	page := &Page{Links: []Link{}}
+	m := &media{}
+	a := &anchor{link: -1}
+	inTitle := false
 	for tt := t.Next(); tt != html.ErrorToken; tt = t.Next() {
+		switch tt {
+		case html.TextToken:
+			if inTitle {
+				m.title += string(t.Text())
+			}
+			a.text.Write(t.Text())
+			continue
+		case html.EndTagToken:
+			name, _ := t.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "a":
+				a.close(page)
+			}
+			m.end(string(name))
+			continue
+		case html.StartTagToken, html.SelfClosingTagToken:
+		default:
+			continue
+		}
 		token := t.Token()
-		if tt == html.StartTagToken && token.Data == "a" {
-			attr := token.Attr
-			for _, a := range attr {
-				// Removing spaces as they are valid in html
-
-				v := strings.TrimSpace(a.Val)
-				key := strings.TrimSpace(a.Key)
-				if key == "href" {
-					urls = append(urls, v)
+		attrs := make(map[string]string, len(token.Attr))
+		for _, a := range token.Attr {
+			// Removing spaces as they are valid in html
+			attrs[strings.TrimSpace(a.Key)] = strings.TrimSpace(a.Val)
+		}
+		m.element(token.Data, attrs)
+		a.element(page, token.Data, attrs)
+		page.addAnchor(attrs["id"])
+		if token.Data == "a" {
+			page.addAnchor(attrs["name"])
+		}
+
+		switch token.Data {
+		case "title":
+			// Only the first title is the one of the document
+			inTitle = tt == html.StartTagToken && m.title == ""
+			continue
+		case "base":
+			if v, ok := attrs["href"]; ok && page.Base == "" {
+				page.Base = v
+			}
+			continue
+		case "meta":
+			if strings.EqualFold(attrs["http-equiv"], "refresh") {
+				if u := refreshURL(attrs["content"]); u != "" {
+					page.Links = append(page.Links, Link{URL: u,
+						Tag: "meta", Attr: "content"})
 				}
 			}
+			if page.Modified == "" && isModifiedMeta(attrs) {
+				page.Modified = attrs["content"]
+			}
+			if strings.EqualFold(attrs["name"], "robots") {
+				page.setDirectives(attrs["content"])
+			}
+			m.meta(attrs)
+			continue
+		}
+
+		for _, key := range linkAttrs[token.Data] {
+			v, ok := attrs[key]
+			if !ok || v == "" {
+				continue
+			}
+			urls := []string{v}
+			if key == "srcset" {
+				urls = srcsetURLs(v)
+			}
+			for _, u := range urls {
+				l := Link{URL: u, Tag: token.Data, Attr: key,
+					Rel: attrs["rel"]}
+				if token.Data == "link" && HasRel(l.Rel, "alternate") {
+					l.Hreflang = attrs["hreflang"]
+				}
+				if token.Data == "link" && HasRel(l.Rel, "canonical") &&
+					page.Canonical == "" {
+					page.Canonical = u
+				}
+				page.Links = append(page.Links, l)
+			}
+		}
+		if token.Data == "a" && tt == html.StartTagToken &&
+			attrs["href"] != "" {
+			a.link = len(page.Links) - 1
+		}
+	}
+	a.close(page)
+	m.title = strings.TrimSpace(m.title)
+	page.Title = m.title
+	m.fill(page)
+	return page
+}
+
+// addAnchor records name as an anchor of the page if it isn't already
+func (page *Page) addAnchor(name string) {
+	if name == "" {
+		return
+	}
+	for _, a := range page.Anchors {
+		if a == name {
+			return
+		}
+	}
+	page.Anchors = append(page.Anchors, name)
+}
+
+// anchor collects the text of the a element being parsed
+type anchor struct {
+	// link is the index of the link of the element in the page,
+	// -1 if there's none
+	link int
+	text strings.Builder
+}
+
+// element closes the a element being parsed when another one starts,
+// images inside it give their alt text
+func (a *anchor) element(page *Page, tag string, attrs map[string]string) {
+	switch tag {
+	case "a":
+		a.close(page)
+	case "img":
+		a.text.WriteString(" " + attrs["alt"] + " ")
+	}
+}
+
+// close sets the text collected as the one of the link of
+// the a element being parsed
+func (a *anchor) close(page *Page) {
+	if a.link >= 0 {
+		page.Links[a.link].Text = strings.Join(
+			strings.Fields(a.text.String()), " ")
+	}
+	a.link = -1
+	a.text.Reset()
+}
+
+// HasRel tells whether the rel attribute value rel contains v,
+// i.e. "alternate nofollow" contains nofollow
+func HasRel(rel, v string) bool {
+	for _, r := range strings.Fields(rel) {
+		if strings.EqualFold(r, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// isModifiedMeta tells whether a meta element gives the
+// last modification date of the page
+func isModifiedMeta(attrs map[string]string) bool {
+	for _, k := range []string{"name", "property", "itemprop"} {
+		if _, ok := modifiedMetas[strings.ToLower(attrs[k])]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// srcsetURLs gives the urls of a srcset attribute
+// i.e. "a.png 1x, b.png 2x" gives a.png and b.png
+func srcsetURLs(v string) []string {
+	var urls []string
+	for _, c := range strings.Split(v, ",") {
+		f := strings.Fields(c)
+		if len(f) > 0 {
+			urls = append(urls, f[0])
 		}
 	}
 	return urls
 }
+
+// refreshURL gives the url of a meta refresh content
+// i.e. "5; url='/next'" gives /next
+func refreshURL(content string) string {
+	i := strings.Index(content, ";")
+	if i < 0 {
+		return ""
+	}
+	v := strings.TrimSpace(content[i+1:])
+	if len(v) < 4 || !strings.EqualFold(v[:3], "url") {
+		return ""
+	}
+	v = strings.TrimSpace(v[3:])
+	if !strings.HasPrefix(v, "=") {
+		return ""
+	}
+	v = strings.TrimSpace(v[1:])
+	return strings.Trim(v, `'"`)
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"io/ioutil"
@@ -58,7 +59,7 @@ func TestNew(t *testing.T) {
 type fakeClient struct {
 }
 
-func (f *fakeClient) Get(url string) (*http.Response, error) {
+func (f *fakeClient) Do(req *http.Request) (*http.Response, error) {
 	resp := &http.Response{}
 	resp.Header = make(map[string][]string)
 	resp.Header.Set("Content-Type", "text/html")
@@ -71,7 +72,7 @@ func (f *fakeClient) Get(url string) (*http.Response, error) {
 type fakeClientStatusNotFound struct {
 }
 
-func (f *fakeClientStatusNotFound) Get(url string) (*http.Response, error) {
+func (f *fakeClientStatusNotFound) Do(req *http.Request) (*http.Response, error) {
 	resp := &http.Response{}
 	resp.Header = make(map[string][]string)
 	resp.Header.Set("Content-Type", "text/html")
@@ -84,7 +85,7 @@ func (f *fakeClientStatusNotFound) Get(url string) (*http.Response, error) {
 type fakeClientErr struct {
 }
 
-func (f *fakeClientErr) Get(url string) (*http.Response, error) {
+func (f *fakeClientErr) Do(req *http.Request) (*http.Response, error) {
 	return nil, errors.New("Failed to open page")
 
 }
@@ -92,7 +93,7 @@ func (f *fakeClientErr) Get(url string) (*http.Response, error) {
 type fakeClientInvalidContentTypeErr struct {
 }
 
-func (f *fakeClientInvalidContentTypeErr) Get(url string) (*http.Response,
+func (f *fakeClientInvalidContentTypeErr) Do(req *http.Request) (*http.Response,
 	error) {
 	resp := &http.Response{}
 	resp.StatusCode = http.StatusOK
@@ -109,24 +110,27 @@ func Test_parser_ExtractURLs(t *testing.T) {
 	type args struct {
 		url string
 	}
-	want := []string{
-		"https://en.wikipedia.org/wiki/H._G._Wells",
-		"http://gutenberg.net.au/ebooks13/1303101h.html/",
-		"http://gutenberg.net/",
-		"http://archive.org",
+	want := []Link{
+		{URL: "https://en.wikipedia.org/wiki/H._G._Wells", Tag: "a", Attr: "href",
+			Text: "HG Wells"},
+		{URL: "http://gutenberg.net.au/ebooks13/1303101h.html/", Tag: "a", Attr: "href",
+			Text: "Sleeper Awakes"},
+		{URL: "http://gutenberg.net/", Tag: "a", Attr: "href", Text: "Gutenberg"},
+		{URL: "http://archive.org", Tag: "a", Attr: "href", Text: "Archive.org"},
 	}
+	fetchOK := Fetch{Status: 200, ContentType: "text/html"}
 	tests := []struct {
 		name    string
 		fields  fields
 		args    args
-		want    []string
+		want    *Page
 		wantErr bool
 	}{
 		{
 			name:    "Test_parser_ExtractURLs 1 - POS",
 			fields:  fields{&fakeClient{}},
 			args:    args{"test-url"},
-			want:    want,
+			want:    &Page{Links: want, Fetch: fetchOK},
 			wantErr: false,
 		},
 		{
@@ -140,14 +144,14 @@ func Test_parser_ExtractURLs(t *testing.T) {
 			name:    "Test_parser_ExtractURLs 3 - NEG",
 			fields:  fields{&fakeClientInvalidContentTypeErr{}},
 			args:    args{"test-url"},
-			want:    nil,
+			want:    &Page{Fetch: Fetch{Status: 200, ContentType: "text/csv"}},
 			wantErr: true,
 		},
 		{
 			name:    "Test_parser_ExtractURLs 4 - NEG",
 			fields:  fields{&fakeClientStatusNotFound{}},
 			args:    args{"test-url"},
-			want:    nil,
+			want:    &Page{Fetch: Fetch{Status: 404, ContentType: "text/html"}},
 			wantErr: true,
 		},
 	}
@@ -160,11 +164,16 @@ func Test_parser_ExtractURLs(t *testing.T) {
 				concurrent: 2,
 				cond:       sync.NewCond(&sync.Mutex{}),
 			}
-			got, err := p.ExtractURLs(tt.args.url)
+			got, err := p.ExtractURLs(context.Background(), tt.args.url,
+				Options{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("parser.GetURLs() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if got != nil {
+				// Response time isn't predictable
+				got.Fetch.ResponseTime = 0
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("parser.GetURLs() = %v, want %v", got, tt.want)
 			}
@@ -172,6 +181,71 @@ func Test_parser_ExtractURLs(t *testing.T) {
 	}
 }
 
+func Test_parser_ExtractURLsCancelled(t *testing.T) {
+	p := &parser{
+		client:     &fakeClient{},
+		log:        log.New(ioutil.Discard, "logger: ", log.Lshortfile),
+		concurrent: 2,
+		cond:       sync.NewCond(&sync.Mutex{}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	got, err := p.ExtractURLs(ctx, "test-url", Options{})
+	if err != context.Canceled {
+		t.Errorf("parser.ExtractURLs() error = %v, want %v", err,
+			context.Canceled)
+	}
+	if got != nil {
+		t.Errorf("parser.ExtractURLs() = %v, want nil", got)
+	}
+}
+
+// waitClient holds requests to slow.io back in Wait until held
+// is closed
+type waitClient struct {
+	redirectClient
+	held chan struct{}
+}
+
+func (w waitClient) Wait(ctx context.Context, host string) error {
+	if host != "slow.io" {
+		return nil
+	}
+	select {
+	case <-w.held:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func Test_parser_ExtractURLsWait(t *testing.T) {
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	client := waitClient{redirectClient: redirectClient{},
+		held: make(chan struct{})}
+	p := New(client, l, false, 1)
+
+	done := make(chan error)
+	go func() {
+		_, err := p.ExtractURLs(context.Background(), "https://slow.io",
+			Options{})
+		done <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := p.ExtractURLs(ctx, "https://fast.io", Options{}); err != nil {
+		t.Errorf("parser.ExtractURLs() while a host is held back"+
+			" error = %v", err)
+	}
+	close(client.held)
+	if err := <-done; err != nil {
+		t.Errorf("parser.ExtractURLs() of the host held back error = %v",
+			err)
+	}
+}
+
 func Test_parser_ExtractURLsParallel(t *testing.T) {
 	type fields struct {
 		client transportClient
@@ -201,7 +275,8 @@ func Test_parser_ExtractURLsParallel(t *testing.T) {
 
 		for i := 0; i < 100; i++ {
 			go func() {
-				p.ExtractURLs(test.args.url)
+				p.ExtractURLs(context.Background(), test.args.url,
+					Options{})
 			}()
 		}
 		p.cond.L.Lock()
@@ -230,7 +305,7 @@ func Test_parser_ExtractURLsParallel(t *testing.T) {
 	})
 }
 
-func Test_parser_linksInBody(t *testing.T) {
+func Test_parser_parseBody(t *testing.T) {
 	type fields struct {
 		client transportClient
 	}
@@ -238,25 +313,55 @@ func Test_parser_linksInBody(t *testing.T) {
 		body io.ReadCloser
 	}
 
-	want := []string{
-		"https://en.wikipedia.org/wiki/H._G._Wells",
-		"http://gutenberg.net.au/ebooks13/1303101h.html/",
-		"http://gutenberg.net/",
-		"http://archive.org",
+	want := []Link{
+		{URL: "https://en.wikipedia.org/wiki/H._G._Wells", Tag: "a", Attr: "href",
+			Text: "HG Wells"},
+		{URL: "http://gutenberg.net.au/ebooks13/1303101h.html/", Tag: "a", Attr: "href",
+			Text: "Sleeper Awakes"},
+		{URL: "http://gutenberg.net/", Tag: "a", Attr: "href", Text: "Gutenberg"},
+		{URL: "http://archive.org", Tag: "a", Attr: "href", Text: "Archive.org"},
+	}
+
+	allLinks := []Link{
+		{URL: "/refresh", Tag: "meta", Attr: "content"},
+		{URL: "/style.css", Tag: "link", Attr: "href", Rel: "stylesheet"},
+		{URL: "/fr/", Tag: "link", Attr: "href", Rel: "Alternate",
+			Hreflang: "fr"},
+		{URL: "/feed", Tag: "link", Attr: "href", Rel: "alternate"},
+		{URL: "/app.js", Tag: "script", Attr: "src"},
+		{URL: "/next", Tag: "a", Attr: "href", Rel: "next", Text: "next"},
+		{URL: "/area", Tag: "area", Attr: "href"},
+		{URL: "/iframe", Tag: "iframe", Attr: "src"},
+		{URL: "/frame", Tag: "frame", Attr: "src"},
+		{URL: "/search", Tag: "form", Attr: "action"},
+		{URL: "/a.png", Tag: "img", Attr: "src"},
+		{URL: "/a-1x.png", Tag: "img", Attr: "srcset"},
+		{URL: "/a-2x.png", Tag: "img", Attr: "srcset"},
+		{URL: "/b.webp", Tag: "source", Attr: "srcset"},
 	}
 
 	tests := []struct {
 		name   string
 		fields fields
 		args   args
-		want   []string
+		want   *Page
 	}{
 		{
-			name:   "Test_parser_linksInBody - 1",
+			name:   "Test_parser_parseBody - 1",
 			fields: fields{},
 			args: args{ioutil.NopCloser(
 				bytes.NewReader([]byte(HTMLData)))},
-			want: want,
+			want: &Page{Links: want},
+		},
+		{
+			name:   "Test_parser_parseBody - 2 all elements",
+			fields: fields{},
+			args: args{ioutil.NopCloser(
+				bytes.NewReader([]byte(HTMLAllLinks)))},
+			want: &Page{Base: "https://cdn.ex.io/docs/",
+				Modified: "2018-08-07T10:00:00+02:00", Links: allLinks,
+				Anchors: []string{"anchor-only"},
+				Images:  []Image{{URL: "/a.png"}}},
 		},
 	}
 	for _, tt := range tests {
@@ -264,14 +369,77 @@ func Test_parser_linksInBody(t *testing.T) {
 			p := &parser{
 				client: tt.fields.client,
 			}
-			if got := p.linksInBody(tt.args.body); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("parser.linskInHTML() = %v, want %v", got, tt.want)
+			if got := p.parseBody(tt.args.body); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parser.parseBody() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func TestHasRel(t *testing.T) {
+	tests := []struct {
+		rel  string
+		v    string
+		want bool
+	}{
+		{"alternate", "alternate", true},
+		{" noopener  NoFollow", "nofollow", true},
+		{"alternates", "alternate", false},
+		{"", "nofollow", false},
+	}
+	for _, tt := range tests {
+		if got := HasRel(tt.rel, tt.v); got != tt.want {
+			t.Errorf("HasRel(%q, %q) = %v, want %v", tt.rel, tt.v, got,
+				tt.want)
+		}
+	}
+}
+
+func Test_refreshURL(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"0; url=/next", "/next"},
+		{"5;URL='https://a.io/x'", "https://a.io/x"},
+		{"5", ""},
+		{"5; foo=/x", ""},
+	}
+	for _, tt := range tests {
+		if got := refreshURL(tt.content); got != tt.want {
+			t.Errorf("refreshURL(%q) = %q, want %q", tt.content, got,
+				tt.want)
+		}
+	}
+}
+
 var (
+	HTMLAllLinks = `
+<html>
+<head>
+<base href="https://cdn.ex.io/docs/">
+<base href="https://ignored.io/">
+<meta http-equiv="Refresh" content="10; url=/refresh">
+<meta name="description" content="not a link">
+<meta property="article:modified_time" content="2018-08-07T10:00:00+02:00">
+<link rel="stylesheet" href="/style.css">
+<link rel="Alternate" hreflang="fr" href="/fr/">
+<link rel="alternate" type="application/rss+xml" href="/feed">
+<script src="/app.js"></script>
+</head>
+<body>
+<a rel="next" href="/next">next</a>
+<a name="anchor-only">no href</a>
+<map><area href="/area"></map>
+<iframe src="/iframe"></iframe>
+<frameset><frame src="/frame"></frameset>
+<form action="/search"></form>
+<img src="/a.png" srcset="/a-1x.png 1x, /a-2x.png 2x"/>
+<picture><source srcset="/b.webp"></picture>
+</body>
+</html>
+`
+
 	HTMLData = `
 <!doctype html>
 <html lang="en-US">
@@ -302,3 +470,46 @@ var (
 </html>
 `
 )
+
+func Test_parser_parseBodyAnchors(t *testing.T) {
+	body := `<body>
+<h1 id="intro">Intro</h1>
+<a name="legacy"></a><a id="both" name="both-name" href="#intro">x</a>
+<div name="not-an-anchor"><p id="intro">duplicate</p></div>
+<section id=""></section>
+</body>`
+	p := &parser{}
+	got := p.parseBody(ioutil.NopCloser(bytes.NewReader([]byte(body))))
+	want := []string{"intro", "legacy", "both", "both-name"}
+	if !reflect.DeepEqual(got.Anchors, want) {
+		t.Errorf("parser.parseBody() Anchors = %v, want %v", got.Anchors,
+			want)
+	}
+}
+
+func Test_parser_parseBodyAnchorText(t *testing.T) {
+	body := `<body>
+<a href="/a">Read
+  <b>the  docs</b></a>
+<a href="/logo"><img src="/logo.png" alt="Home"></a>
+<a href="/unclosed">first <a href="/next">second</a>
+<a name="no-href">ignored</a> text
+</body>`
+	p := &parser{}
+	got := p.parseBody(ioutil.NopCloser(bytes.NewReader([]byte(body))))
+	want := map[string]string{
+		"/a":        "Read the docs",
+		"/logo":     "Home",
+		"/logo.png": "",
+		"/unclosed": "first",
+		"/next":     "second",
+	}
+	if len(got.Links) != len(want) {
+		t.Fatalf("parser.parseBody() Links = %v", got.Links)
+	}
+	for _, l := range got.Links {
+		if l.Text != want[l.URL] {
+			t.Errorf("%s Text = %q, want %q", l.URL, l.Text, want[l.URL])
+		}
+	}
+}
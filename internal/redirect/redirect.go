@@ -0,0 +1,138 @@
+// Package redirect follows the http redirections of a request, clients
+// of the crawler don't follow them so that every hop can be checked
+// and recorded
+package redirect
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultMax is the number of redirections followed when Config
+// doesn't set one
+const DefaultMax = 10
+
+var (
+	// ErrLoop is returned when a redirection leads to a url
+	// already in the chain
+	ErrLoop = errors.New("redirect loop")
+	// ErrTooMany is returned when more redirections than the
+	// maximum would be followed
+	ErrTooMany = errors.New("too many redirects")
+	// ErrNotAllowed is returned when a redirection leads to a url
+	// refused by Config.Allow
+	ErrNotAllowed = errors.New("redirect target not allowed")
+)
+
+// transportClient defines the interface needed to make requests
+type transportClient interface {
+	Do(req *http.Request) (resp *http.Response, err error)
+}
+
+// Config tells which redirections are followed
+type Config struct {
+	// Max is the number of redirections followed, DefaultMax if 0
+	Max int
+	// Allow tells whether a redirection target may be requested,
+	// every target is allowed if it's nil
+	Allow func(u *url.URL) bool
+}
+
+// Hop is a url which answered with a redirection
+type Hop struct {
+	URL    string
+	Status int
+}
+
+// Result is the outcome of a request whose redirections were followed
+type Result struct {
+	// Response is the final response, or the last redirection if it
+	// wasn't followed, its body is then already closed
+	Response *http.Response
+	// URL is the url Response was got from
+	URL *url.URL
+	// Elapsed is the time taken to get Response
+	Elapsed time.Duration
+	// Hops are the urls which answered with a redirection in order,
+	// the url of Response included if it wasn't followed
+	Hops []Hop
+	// Next is the target of Response if it's a redirection which
+	// wasn't followed
+	Next *url.URL
+}
+
+// Do sends req with client and follows the redirections it answers
+// with, until a response which isn't a redirection
+// Redirections are requested with the method of req but none of its
+// headers, i.e. conditional ones, as they may not apply to other urls
+// A Result is returned along with ErrLoop, ErrTooMany or ErrNotAllowed
+// when a redirection isn't followed, the error of client is returned
+// alone
+func Do(client transportClient, req *http.Request, c Config) (*Result,
+	error) {
+	max := c.Max
+	if max == 0 {
+		max = DefaultMax
+	}
+
+	r := &Result{}
+	seen := map[string]struct{}{req.URL.String(): {}}
+	for {
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		r.Response, r.URL, r.Elapsed = resp, req.URL, time.Since(start)
+		r.Next = nil
+
+		next, ok := Location(req.URL, resp)
+		if !ok {
+			return r, nil
+		}
+		resp.Body.Close()
+
+		r.Hops = append(r.Hops, Hop{URL: req.URL.String(),
+			Status: resp.StatusCode})
+		r.Next = next
+		if _, ok := seen[next.String()]; ok {
+			return r, ErrLoop
+		}
+		if len(r.Hops) > max {
+			return r, ErrTooMany
+		}
+		if c.Allow != nil && !c.Allow(next) {
+			return r, ErrNotAllowed
+		}
+		seen[next.String()] = struct{}{}
+
+		req, err = http.NewRequestWithContext(req.Context(), req.Method,
+			next.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Location gives the url resp, got from u, redirects to if it's
+// a redirection
+func Location(u *url.URL, resp *http.Response) (*url.URL, bool) {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound,
+		http.StatusSeeOther, http.StatusTemporaryRedirect,
+		http.StatusPermanentRedirect:
+	default:
+		return nil, false
+	}
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return nil, false
+	}
+	next, err := u.Parse(loc)
+	if err != nil {
+		return nil, false
+	}
+	return next, true
+}
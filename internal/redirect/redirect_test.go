@@ -0,0 +1,118 @@
+package redirect
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeClient answers with the redirections of locations, other urls
+// give 200, it records the requests made
+type fakeClient struct {
+	locations map[string]string
+	requests  []string
+}
+
+func (f *fakeClient) Do(req *http.Request) (*http.Response, error) {
+	f.requests = append(f.requests, req.Method+" "+req.URL.String()+" "+
+		req.Header.Get("If-None-Match"))
+	if req.URL.Host == "down.io" {
+		return nil, errors.New("connection refused")
+	}
+	resp := &http.Response{
+		Request:    req,
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}
+	if loc, ok := f.locations[req.URL.String()]; ok {
+		resp.StatusCode = http.StatusFound
+		resp.Header.Set("Location", loc)
+	}
+	return resp, nil
+}
+
+func TestDo(t *testing.T) {
+	client := &fakeClient{locations: map[string]string{
+		"https://a.io/old":    "/new",
+		"https://a.io/loop":   "https://a.io/loop2",
+		"https://a.io/loop2":  "/loop",
+		"https://a.io/chain":  "/chain1",
+		"https://a.io/chain1": "/chain2",
+		"https://a.io/chain2": "/chain3",
+		"https://a.io/away":   "https://down.io/",
+		"https://a.io/secret": "/private/x",
+	}}
+	allow := func(u *url.URL) bool {
+		return !strings.HasPrefix(u.Path, "/private")
+	}
+	hop := func(u string) Hop {
+		return Hop{URL: u, Status: http.StatusFound}
+	}
+
+	tests := []struct {
+		url      string
+		config   Config
+		wantURL  string
+		wantHops []Hop
+		wantNext string
+		wantErr  error
+	}{
+		{"https://a.io/", Config{}, "https://a.io/", nil, "", nil},
+		{"https://a.io/old", Config{}, "https://a.io/new",
+			[]Hop{hop("https://a.io/old")}, "", nil},
+		{"https://a.io/loop", Config{}, "https://a.io/loop2",
+			[]Hop{hop("https://a.io/loop"), hop("https://a.io/loop2")},
+			"https://a.io/loop", ErrLoop},
+		{"https://a.io/chain", Config{Max: 2}, "https://a.io/chain2",
+			[]Hop{hop("https://a.io/chain"), hop("https://a.io/chain1"),
+				hop("https://a.io/chain2")}, "https://a.io/chain3",
+			ErrTooMany},
+		{"https://a.io/chain", Config{Max: 3}, "https://a.io/chain3",
+			[]Hop{hop("https://a.io/chain"), hop("https://a.io/chain1"),
+				hop("https://a.io/chain2")}, "", nil},
+		{"https://a.io/secret", Config{Allow: allow}, "https://a.io/secret",
+			[]Hop{hop("https://a.io/secret")}, "https://a.io/private/x",
+			ErrNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req, _ := http.NewRequestWithContext(context.Background(),
+				http.MethodGet, tt.url, nil)
+			r, err := Do(client, req, tt.config)
+			if err != tt.wantErr {
+				t.Fatalf("Do() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := r.URL.String(); got != tt.wantURL {
+				t.Errorf("Do() URL = %s, want %s", got, tt.wantURL)
+			}
+			if !reflect.DeepEqual(r.Hops, tt.wantHops) {
+				t.Errorf("Do() Hops = %v, want %v", r.Hops, tt.wantHops)
+			}
+			next := ""
+			if r.Next != nil {
+				next = r.Next.String()
+			}
+			if next != tt.wantNext {
+				t.Errorf("Do() Next = %s, want %s", next, tt.wantNext)
+			}
+		})
+	}
+
+	client.requests = nil
+	req, _ := http.NewRequestWithContext(context.Background(),
+		http.MethodHead, "https://a.io/away", nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	if r, err := Do(client, req, Config{}); r != nil || err == nil {
+		t.Errorf("Do() = %v, %v, want the error of client", r, err)
+	}
+	want := []string{`HEAD https://a.io/away "v1"`, "HEAD https://down.io/ "}
+	if !reflect.DeepEqual(client.requests, want) {
+		t.Errorf("requests = %q, want %q", client.requests, want)
+	}
+}
@@ -0,0 +1,135 @@
+// Package retry decides whether a failed request is tried again
+// and how long to wait before it
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultStatuses are the status codes retried when Policy.Statuses
+// isn't set
+var DefaultStatuses = []int{408, 425, 429, 500, 502, 503, 504}
+
+// defaultMax caps the backoff when Policy.Max isn't set
+const defaultMax = 30 * time.Second
+
+// Policy tells how many times and when a request is retried
+type Policy struct {
+	// Attempts is the maximum number of tries of a request,
+	// 1 or less means it isn't retried
+	Attempts int
+	// Base is the backoff before the first retry, it doubles
+	// on every retry up to Max
+	Base time.Duration
+	Max  time.Duration
+	// Statuses are the status codes retried, DefaultStatuses if nil
+	Statuses []int
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// New gives a Policy trying requests up to attempts times,
+// waiting base then twice as long on every retry
+func New(attempts int, base time.Duration) *Policy {
+	return &Policy{Attempts: attempts, Base: base}
+}
+
+// Retry tells whether a request which gave status or err on
+// its attempt-th try, counting from 1, is tried again
+func (p *Policy) Retry(attempt, status int, err error) bool {
+	if p == nil || attempt >= p.Attempts {
+		return false
+	}
+	if err != nil {
+		return Temporary(err)
+	}
+	return p.retryStatus(status)
+}
+
+func (p *Policy) retryStatus(status int) bool {
+	statuses := p.Statuses
+	if statuses == nil {
+		statuses = DefaultStatuses
+	}
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff gives how long to wait before retrying a request which
+// failed on its attempt-th try
+// The delay doubles with every attempt, up to Max, and is picked
+// at random between half of it and all of it so that retries of
+// requests failing together are spread out
+func (p *Policy) Backoff(attempt int) time.Duration {
+	max := p.Max
+	if max <= 0 {
+		max = defaultMax
+	}
+	d := p.Base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if d <= 0 {
+		return 0
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.rnd == nil {
+		p.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return d/2 + time.Duration(p.rnd.Int63n(int64(d/2)+1))
+}
+
+// Temporary tells whether err is a failure which may not happen
+// again, i.e. a timeout or a connection reset
+// Cancelled requests aren't temporary
+func Temporary(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var dns *net.DNSError
+	if errors.As(err, &dns) {
+		return dns.Timeout() || dns.Temporary()
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// Sleep waits for d or until ctx is cancelled
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,100 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestPolicy_Retry(t *testing.T) {
+	p := New(3, time.Millisecond)
+	tests := []struct {
+		name    string
+		attempt int
+		status  int
+		err     error
+		want    bool
+	}{
+		{"503", 1, 503, nil, true},
+		{"429", 2, 429, nil, true},
+		{"last attempt", 3, 503, nil, false},
+		{"404", 1, 404, nil, false},
+		{"200", 1, 200, nil, false},
+		{"timeout", 1, 0, &url.Error{Op: "Get", URL: "https://ex.io",
+			Err: timeoutError{}}, true},
+		{"reset", 1, 0, fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"eof", 1, 0, io.ErrUnexpectedEOF, true},
+		{"dns not found", 1, 0, &net.DNSError{Err: "no such host",
+			IsNotFound: true}, false},
+		{"cancelled", 1, 0, context.Canceled, false},
+		{"other", 1, 0, errors.New("unsupported protocol scheme"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Retry(tt.attempt, tt.status, tt.err); got != tt.want {
+				t.Errorf("Policy.Retry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var none *Policy
+	if none.Retry(1, 503, nil) {
+		t.Error("nil Policy.Retry() = true, want false")
+	}
+	custom := &Policy{Attempts: 2, Statuses: []int{404}}
+	if !custom.Retry(1, 404, nil) || custom.Retry(1, 503, nil) {
+		t.Error("Policy.Retry() doesn't use Statuses")
+	}
+}
+
+func TestPolicy_Backoff(t *testing.T) {
+	p := &Policy{Attempts: 10, Base: 100 * time.Millisecond,
+		Max: time.Second}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{9, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			got := p.Backoff(tt.attempt)
+			if got < tt.max/2 || got > tt.max {
+				t.Fatalf("Policy.Backoff(%d) = %s, want within [%s, %s]",
+					tt.attempt, got, tt.max/2, tt.max)
+			}
+		}
+	}
+}
+
+func TestSleep(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if err := Sleep(ctx, time.Minute); err != context.Canceled {
+		t.Errorf("Sleep() = %v, want %v", err, context.Canceled)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Sleep() didn't return once ctx was cancelled")
+	}
+	if err := Sleep(context.Background(), time.Millisecond); err != nil {
+		t.Errorf("Sleep() = %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package robots
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/khrm/smap/internal/redirect"
+)
+
+// maxSize is the maximum size of robots.txt which is read
+const maxSize = 500 << 10
+
+// maxRedirects is the number of redirections followed to get
+// robots.txt, the five asked by RFC 9309, after them robots.txt
+// is considered missing
+const maxRedirects = 5
+
+// transportClient defines the interface needed to get robots.txt
+type transportClient interface {
+	Do(req *http.Request) (resp *http.Response, err error)
+}
+
+// Cache fetches robots.txt once per host and keeps the result
+type Cache struct {
+	client transportClient
+	agent  string
+	log    *log.Logger
+	debug  bool
+
+	mu    sync.Mutex
+	hosts map[string]*entry
+}
+
+// entry is the robots.txt of a host, done is closed once it's fetched
+type entry struct {
+	done chan struct{}
+	r    *Robots
+}
+
+// NewCache gives an instance of Cache, agent is the user agent
+// used to select the group of rules
+func NewCache(client transportClient, agent string, l *log.Logger,
+	debug bool) *Cache {
+	return &Cache{
+		client: client,
+		agent:  agent,
+		log:    l,
+		debug:  debug,
+		hosts:  make(map[string]*entry),
+	}
+}
+
+// Get returns the robots.txt rules for the host of u
+// The file is fetched on the first call for every host
+func (c *Cache) Get(ctx context.Context, u *url.URL) *Robots {
+	key := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	e, ok := c.hosts[key]
+	if !ok {
+		e = &entry{done: make(chan struct{})}
+		c.hosts[key] = e
+	}
+	c.mu.Unlock()
+
+	if ok {
+		<-e.done
+		return e.r
+	}
+
+	e.r = c.fetch(ctx, key+"/robots.txt")
+	close(e.done)
+	return e.r
+}
+
+// Allowed tells whether u can be crawled
+func (c *Cache) Allowed(ctx context.Context, u *url.URL) bool {
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return c.Get(ctx, u).Allowed(c.agent, path)
+}
+
+// CrawlDelay gives the delay to respect between requests to host of u
+func (c *Cache) CrawlDelay(ctx context.Context, u *url.URL) time.Duration {
+	return c.Get(ctx, u).CrawlDelay(c.agent)
+}
+
+// fetch gets and parses robots.txt
+// A missing file (4xx, a redirect loop or too many redirections)
+// allows everything, while a server error or failed request
+// disallows everything
+func (c *Cache) fetch(ctx context.Context, link string) *Robots {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return &Robots{disallowAll: true}
+	}
+	r, err := redirect.Do(c.client, req, redirect.Config{Max: maxRedirects})
+	if r == nil {
+		if c.debug {
+			c.log.Printf("Error :%s encountered fetching %s", err, link)
+		}
+		return &Robots{disallowAll: true}
+	}
+	resp := r.Response
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		if c.debug {
+			c.log.Printf("robots %s gives %d, disallowing host",
+				link, resp.StatusCode)
+		}
+		return &Robots{disallowAll: true}
+	case resp.StatusCode >= 300:
+		return &Robots{}
+	}
+
+	return Parse(io.LimitReader(resp.Body, maxSize))
+}
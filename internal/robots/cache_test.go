@@ -0,0 +1,75 @@
+package robots
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type fakeClient struct {
+	status int
+	body   string
+	err    error
+	calls  int
+}
+
+func (f *fakeClient) Do(req *http.Request) (*http.Response, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &http.Response{
+		StatusCode: f.status,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(f.body))),
+	}, nil
+}
+
+func TestCache_Allowed(t *testing.T) {
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	u, _ := url.Parse("https://example.com/admin?x=1")
+	tests := []struct {
+		name   string
+		client *fakeClient
+		want   bool
+	}{
+		{
+			name: "disallowed by rules",
+			client: &fakeClient{status: http.StatusOK,
+				body: "User-agent: *\nDisallow: /admin\n"},
+			want: false,
+		},
+		{
+			name:   "missing robots allows all",
+			client: &fakeClient{status: http.StatusNotFound},
+			want:   true,
+		},
+		{
+			name:   "server error disallows all",
+			client: &fakeClient{status: http.StatusServiceUnavailable},
+			want:   false,
+		},
+		{
+			name:   "request error disallows all",
+			client: &fakeClient{err: errors.New("Failed to open page")},
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(tt.client, "smap", l, true)
+			if got := c.Allowed(context.Background(), u); got != tt.want {
+				t.Errorf("Cache.Allowed() = %v, want %v", got, tt.want)
+			}
+			c.Allowed(context.Background(), u)
+			if tt.client.calls != 1 {
+				t.Errorf("robots.txt fetched %d times, want 1",
+					tt.client.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package robots
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Robots contains the rules parsed from a robots.txt file
+type Robots struct {
+	groups []*group
+	// Sitemaps are the urls given in Sitemap: lines, they
+	// don't belong to any user-agent group
+	Sitemaps []string
+	// disallowAll is set when robots.txt couldn't be fetched
+	// because the server failed and nothing can be crawled
+	disallowAll bool
+}
+
+// group is a set of rules applying to a list of user agents
+type group struct {
+	agents     []string
+	rules      []rule
+	crawlDelay time.Duration
+	hasDelay   bool
+}
+
+// rule is a single Allow or Disallow line
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+// Parse reads a robots.txt file and returns its rules
+// Unknown lines and lines without a colon are ignored
+func Parse(r io.Reader) *Robots {
+	rb := &Robots{}
+	var g *group
+	// inRules tells whether the current group already got rules, in that
+	// case a new user-agent line starts a new group
+	inRules := false
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			if g == nil || inRules {
+				g = &group{}
+				rb.groups = append(rb.groups, g)
+				inRules = false
+			}
+			g.agents = append(g.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if g == nil {
+				continue
+			}
+			inRules = true
+			// Empty disallow means everything is allowed
+			if value == "" {
+				continue
+			}
+			if !strings.HasPrefix(value, "/") &&
+				!strings.HasPrefix(value, "*") {
+				value = "/" + value
+			}
+			g.rules = append(g.rules, rule{
+				allow:   key == "allow",
+				pattern: value,
+			})
+		case "crawl-delay":
+			if g == nil {
+				continue
+			}
+			inRules = true
+			d, err := strconv.ParseFloat(value, 64)
+			if err != nil || d < 0 {
+				continue
+			}
+			g.crawlDelay = time.Duration(d * float64(time.Second))
+			g.hasDelay = true
+		case "sitemap":
+			if value != "" {
+				rb.Sitemaps = append(rb.Sitemaps, value)
+			}
+		}
+	}
+	return rb
+}
+
+// groupsFor returns the groups applying to agent
+// Groups naming the agent take precedence over the * group
+func (r *Robots) groupsFor(agent string) []*group {
+	agent = productToken(agent)
+	var specific, wildcard []*group
+	for _, g := range r.groups {
+		for _, a := range g.agents {
+			if a == "*" {
+				wildcard = append(wildcard, g)
+				break
+			}
+			if agent != "" && a == agent {
+				specific = append(specific, g)
+				break
+			}
+		}
+	}
+	if len(specific) > 0 {
+		return specific
+	}
+	return wildcard
+}
+
+// Allowed tells whether agent may fetch path
+// path should contain the query string too, if any
+// Longest matching rule wins, and allow wins on a tie
+func (r *Robots) Allowed(agent, path string) bool {
+	if r == nil {
+		return true
+	}
+	if r.disallowAll {
+		return false
+	}
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+
+	matched := -1
+	allowed := true
+	for _, g := range r.groupsFor(agent) {
+		for _, rl := range g.rules {
+			if !match(rl.pattern, path) {
+				continue
+			}
+			l := len(rl.pattern)
+			if l > matched || (l == matched && rl.allow) {
+				matched = l
+				allowed = rl.allow
+			}
+		}
+	}
+	return allowed
+}
+
+// CrawlDelay returns the delay asked by the site between requests of agent
+// and it's zero if nothing is specified
+func (r *Robots) CrawlDelay(agent string) time.Duration {
+	if r == nil {
+		return 0
+	}
+	for _, g := range r.groupsFor(agent) {
+		if g.hasDelay {
+			return g.crawlDelay
+		}
+	}
+	return 0
+}
+
+// productToken gives the name used to match user-agent lines
+// i.e. smap/1.0 (+https://...) becomes smap
+func productToken(agent string) string {
+	agent = strings.TrimSpace(agent)
+	if i := strings.IndexAny(agent, "/ "); i >= 0 {
+		agent = agent[:i]
+	}
+	return strings.ToLower(agent)
+}
+
+// match tells whether path matches a robots.txt pattern
+// * matches any sequence of characters and a trailing $
+// anchors the pattern at the end of the path
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, p := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(path[pos:], p)
+		}
+		idx := strings.Index(path[pos:], p)
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(p)
+	}
+	return !anchored || pos == len(path)
+}
@@ -0,0 +1,104 @@
+package robots
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var robotsData = `
+# comment line
+User-agent: *
+Disallow: /admin
+Allow: /admin/public
+Disallow: /*.pdf$
+Disallow: /search?
+
+User-agent: smap
+User-agent: otherbot
+Disallow: /private
+Allow: /private/*.html$
+Crawl-delay: 1.5
+
+Sitemap: https://example.com/sitemap.xml
+`
+
+func TestParse(t *testing.T) {
+	r := Parse(strings.NewReader(robotsData))
+	if len(r.groups) != 2 {
+		t.Fatalf("Parse() groups = %d, want %d", len(r.groups), 2)
+	}
+	want := []string{"https://example.com/sitemap.xml"}
+	if !reflect.DeepEqual(r.Sitemaps, want) {
+		t.Errorf("Parse() Sitemaps = %v, want %v", r.Sitemaps, want)
+	}
+	if !reflect.DeepEqual(r.groups[1].agents,
+		[]string{"smap", "otherbot"}) {
+		t.Errorf("Parse() agents = %v", r.groups[1].agents)
+	}
+}
+
+func TestRobots_Allowed(t *testing.T) {
+	r := Parse(strings.NewReader(robotsData))
+	tests := []struct {
+		name  string
+		agent string
+		path  string
+		want  bool
+	}{
+		{"wildcard group disallow", "somebot", "/admin/users", false},
+		{"longest rule wins", "somebot", "/admin/public/x", true},
+		{"anchored pattern", "somebot", "/docs/file.pdf", false},
+		{"anchored pattern no match", "somebot", "/docs/file.pdf?x", true},
+		{"query prefix", "somebot", "/search?q=1", false},
+		{"specific group used", "smap/1.0", "/admin", true},
+		{"specific group disallow", "smap", "/private/a", false},
+		{"specific group wildcard allow", "smap", "/private/a.html", true},
+		{"robots.txt always allowed", "smap", "/robots.txt", true},
+		{"empty path", "somebot", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Allowed(tt.agent, tt.path); got != tt.want {
+				t.Errorf("Robots.Allowed(%q, %q) = %v, want %v",
+					tt.agent, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRobots_CrawlDelay(t *testing.T) {
+	r := Parse(strings.NewReader(robotsData))
+	if got := r.CrawlDelay("smap"); got != 1500*time.Millisecond {
+		t.Errorf("Robots.CrawlDelay() = %v, want %v", got,
+			1500*time.Millisecond)
+	}
+	if got := r.CrawlDelay("somebot"); got != 0 {
+		t.Errorf("Robots.CrawlDelay() = %v, want %v", got, 0)
+	}
+}
+
+func Test_match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/", "/anything", true},
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish", false},
+		{"/fish*.php", "/fish/food.php", true},
+		{"/*.php$", "/index.php", true},
+		{"/*.php$", "/index.php?x", false},
+		{"/a$", "/a", true},
+		{"/a$", "/ab", false},
+		{"/*/b*c$", "/x/b/yc", true},
+	}
+	for _, tt := range tests {
+		if got := match(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.pattern,
+				tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package scope
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// globPrefix marks a pattern as a glob instead of a regular expression
+const globPrefix = "glob:"
+
+// Pattern matches urls, it's either a regular expression matched
+// anywhere in the url or a glob prefixed by glob: matching the whole url
+// A glob starting with / is matched against path and query only
+type Pattern struct {
+	raw      string
+	re       *regexp.Regexp
+	pathOnly bool
+}
+
+// Compile parses a pattern
+func Compile(p string) (*Pattern, error) {
+	if !strings.HasPrefix(p, globPrefix) {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		return &Pattern{raw: p, re: re}, nil
+	}
+
+	g := strings.TrimPrefix(p, globPrefix)
+	re, err := regexp.Compile(globToRegexp(g))
+	if err != nil {
+		return nil, err
+	}
+	return &Pattern{raw: p, re: re, pathOnly: strings.HasPrefix(g, "/")}, nil
+}
+
+// Match tells whether u matches the pattern
+func (p *Pattern) Match(u *url.URL) bool {
+	if !p.pathOnly {
+		return p.re.MatchString(u.String())
+	}
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return p.re.MatchString(path)
+}
+
+// String gives the pattern as it was written
+func (p *Pattern) String() string {
+	return p.raw
+}
+
+// globToRegexp converts a glob in an anchored regular expression
+// ** matches anything, * anything but / and ? a single character but /
+func globToRegexp(g string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(g); i++ {
+		switch c := g[i]; {
+		case c == '*' && i+1 < len(g) && g[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// Filter selects urls with include and exclude patterns
+type Filter struct {
+	include []*Pattern
+	exclude []*Pattern
+}
+
+// NewFilter compiles include and exclude patterns in a Filter
+func NewFilter(include, exclude []string) (*Filter, error) {
+	f := &Filter{}
+	for _, p := range include {
+		c, err := Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, c)
+	}
+	for _, p := range exclude {
+		c, err := Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, c)
+	}
+	return f, nil
+}
+
+// Check tells whether u passes the filter, if not it also
+// gives the reason why it was rejected
+// Exclude patterns win over include patterns, and when no include
+// pattern is given every url not excluded passes
+func (f *Filter) Check(u *url.URL) (bool, string) {
+	for _, p := range f.exclude {
+		if p.Match(u) {
+			return false, "excluded by pattern " + p.String()
+		}
+	}
+	if len(f.include) == 0 {
+		return true, ""
+	}
+	for _, p := range f.include {
+		if p.Match(u) {
+			return true, ""
+		}
+	}
+	return false, "not matching any include pattern"
+}
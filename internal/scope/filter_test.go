@@ -0,0 +1,53 @@
+package scope
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestFilter_Check(t *testing.T) {
+	f, err := NewFilter(
+		[]string{"/docs", "glob:/blog/**"},
+		[]string{`/search\?`, "glob:/docs/*/archive"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url        string
+		want       bool
+		wantReason string
+	}{
+		{"https://a.io/docs/install", true, ""},
+		{"https://a.io/blog/2018/hello", true, ""},
+		{"https://a.io/docs/search?q=x", false, `excluded by pattern /search\?`},
+		{"https://a.io/docs/v1/archive", false, "excluded by pattern glob:/docs/*/archive"},
+		{"https://a.io/docs/v1/x/archive", true, ""},
+		{"https://a.io/admin", false, "not matching any include pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			got, reason := f.Check(u)
+			if got != tt.want || reason != tt.wantReason {
+				t.Errorf("Filter.Check() = %v, %q, want %v, %q", got,
+					reason, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	if _, err := Compile("(unclosed"); err == nil {
+		t.Errorf("Compile() error = nil, want error")
+	}
+	p, err := Compile("glob:https://a.io/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("https://a.io/index.html")
+	if !p.Match(u) {
+		t.Errorf("Pattern.Match(%s) = false, want true", u)
+	}
+}
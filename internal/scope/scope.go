@@ -0,0 +1,119 @@
+package scope
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Scope decides whether a url belongs to the crawl
+// Urls out of scope are neither crawled nor added to the sitemap
+type Scope interface {
+	InScope(u *url.URL) bool
+}
+
+// Func adapts a function to the Scope interface
+type Func func(u *url.URL) bool
+
+// InScope calls f(u)
+func (f Func) InScope(u *url.URL) bool {
+	return f(u)
+}
+
+// Any accepts every http and https url
+func Any() Scope {
+	return Func(isHTTP)
+}
+
+// Host accepts urls whose host is exactly host
+// Port of the url isn't taken into account
+func Host(host string) Scope {
+	host = hostname(host)
+	return Func(func(u *url.URL) bool {
+		return isHTTP(u) && hostname(u.Host) == host
+	})
+}
+
+// Subdomains accepts urls of host and of all its subdomains
+func Subdomains(host string) Scope {
+	host = hostname(host)
+	return Func(func(u *url.URL) bool {
+		h := hostname(u.Host)
+		return isHTTP(u) &&
+			(h == host || strings.HasSuffix(h, "."+host))
+	})
+}
+
+// Domain accepts urls sharing the registrable domain of host
+// i.e. for docs.example.co.uk, every host under example.co.uk
+func Domain(host string) Scope {
+	host = hostname(host)
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		// host is a public suffix or an ip, nothing else can share it
+		return Host(host)
+	}
+	return Subdomains(domain)
+}
+
+// Hosts accepts urls whose host is one of hosts
+func Hosts(hosts ...string) Scope {
+	allowed := make(map[string]struct{}, len(hosts))
+	for _, h := range hosts {
+		allowed[hostname(h)] = struct{}{}
+	}
+	return Func(func(u *url.URL) bool {
+		_, ok := allowed[hostname(u.Host)]
+		return isHTTP(u) && ok
+	})
+}
+
+// PathPrefix accepts urls whose path starts with prefix
+// Prefix is matched on path segments, so /docs accepts
+// /docs and /docs/a but not /docsearch
+func PathPrefix(prefix string) Scope {
+	prefix = "/" + strings.Trim(prefix, "/")
+	return Func(func(u *url.URL) bool {
+		if prefix == "/" {
+			return true
+		}
+		p := u.Path
+		return p == prefix || strings.HasPrefix(p, prefix+"/")
+	})
+}
+
+// All accepts urls accepted by every one of scopes
+func All(scopes ...Scope) Scope {
+	return Func(func(u *url.URL) bool {
+		for _, s := range scopes {
+			if !s.InScope(u) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// OneOf accepts urls accepted by at least one of scopes
+func OneOf(scopes ...Scope) Scope {
+	return Func(func(u *url.URL) bool {
+		for _, s := range scopes {
+			if s.InScope(u) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// isHTTP tells whether u can be crawled at all
+func isHTTP(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// hostname lowercases host and removes its port and trailing dot
+func hostname(host string) string {
+	u := url.URL{Host: host}
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
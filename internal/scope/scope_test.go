@@ -0,0 +1,48 @@
+package scope
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestScopes(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope Scope
+		url   string
+		want  bool
+	}{
+		{"host exact", Host("goharbor.io"), "https://goharbor.io/docs", true},
+		{"host with port", Host("goharbor.io"), "https://GoHarbor.io:443/", true},
+		{"host query trick", Host("goharbor.io"), "https://evil.com/?goharbor.io", false},
+		{"host suffix trick", Host("goharbor.io"), "https://goharbor.io.attacker.net/", false},
+		{"host subdomain", Host("goharbor.io"), "https://www.goharbor.io/", false},
+		{"host mailto", Host("goharbor.io"), "mailto://goharbor.io", false},
+		{"subdomains sub", Subdomains("goharbor.io"), "https://docs.goharbor.io/", true},
+		{"subdomains self", Subdomains("goharbor.io"), "http://goharbor.io/", true},
+		{"subdomains lookalike", Subdomains("goharbor.io"), "https://evilgoharbor.io/", false},
+		{"domain sibling", Domain("docs.example.co.uk"), "https://blog.example.co.uk/", true},
+		{"domain other", Domain("docs.example.co.uk"), "https://other.co.uk/", false},
+		{"hosts listed", Hosts("a.io", "b.io"), "https://b.io/x", true},
+		{"hosts unlisted", Hosts("a.io", "b.io"), "https://c.io/x", false},
+		{"prefix self", PathPrefix("/docs/"), "https://a.io/docs", true},
+		{"prefix child", PathPrefix("/docs"), "https://a.io/docs/install", true},
+		{"prefix sibling", PathPrefix("/docs"), "https://a.io/docsearch", false},
+		{"all", All(Host("a.io"), PathPrefix("/docs")), "https://a.io/blog", false},
+		{"one of", OneOf(Host("a.io"), Subdomains("b.io")), "https://x.b.io/", true},
+		{"none of", OneOf(Host("a.io"), Host("b.io")), "https://c.io/", false},
+		{"any", Any(), "https://anything.io/", true},
+		{"any ftp", Any(), "ftp://anything.io/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.scope.InScope(u); got != tt.want {
+				t.Errorf("InScope(%s) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package seed
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/khrm/smap/internal/redirect"
+)
+
+// maxSize is the maximum size of a sitemap file which is read,
+// it's the limit given by the sitemaps protocol
+const maxSize = 50 << 20
+
+// maxSitemaps is the maximum number of sitemap files read,
+// sitemap indexes included
+const maxSitemaps = 1000
+
+// transportClient defines the interface needed to get sitemaps
+type transportClient interface {
+	Do(req *http.Request) (resp *http.Response, err error)
+}
+
+// Loader fetches sitemaps and the sitemaps of their indexes
+type Loader struct {
+	client transportClient
+	log    *log.Logger
+	debug  bool
+}
+
+// NewLoader gives an instance of Loader
+func NewLoader(client transportClient, l *log.Logger, debug bool) *Loader {
+	return &Loader{client: client, log: l, debug: debug}
+}
+
+// Load gives the urls of pages listed in sitemaps, sitemap indexes
+// are followed, sitemaps which can't be read are ignored
+// Urls are given in the order they were found, without duplicates
+func (l *Loader) Load(ctx context.Context, sitemaps ...string) []string {
+	var urls []string
+	seenURLs := map[string]struct{}{}
+	seen := map[string]struct{}{}
+	queue := append([]string(nil), sitemaps...)
+	for len(queue) > 0 && len(seen) < maxSitemaps && ctx.Err() == nil {
+		link := queue[0]
+		queue = queue[1:]
+		if _, ok := seen[link]; ok {
+			continue
+		}
+		seen[link] = struct{}{}
+
+		s, err := l.fetch(ctx, link)
+		if err != nil {
+			if l.debug {
+				l.log.Printf("Error :%s encountered reading sitemap %s",
+					err, link)
+			}
+			continue
+		}
+		queue = append(queue, s.Sitemaps...)
+		for _, u := range s.URLs {
+			if _, ok := seenURLs[u]; !ok {
+				seenURLs[u] = struct{}{}
+				urls = append(urls, u)
+			}
+		}
+	}
+	return urls
+}
+
+// fetch gets and parses the sitemap at link
+func (l *Loader) fetch(ctx context.Context, link string) (*Sitemap,
+	error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	r, err := redirect.Do(l.client, req, redirect.Config{})
+	if err != nil {
+		return nil, err
+	}
+	resp := r.Response
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sitemap gives %d", resp.StatusCode)
+	}
+	return Parse(io.LimitReader(resp.Body, maxSize))
+}
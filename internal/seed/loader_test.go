@@ -0,0 +1,55 @@
+package seed
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeClient serves the files of a map, urls not in it give 404
+type fakeClient map[string]string
+
+func (f fakeClient) Do(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	body, ok := f[req.URL.String()]
+	switch {
+	case !ok:
+		resp.StatusCode = http.StatusNotFound
+	case strings.HasPrefix(body, "redirect:"):
+		resp.StatusCode = http.StatusMovedPermanently
+		resp.Header.Set("Location", strings.TrimPrefix(body, "redirect:"))
+		body = ""
+	}
+	resp.Body = ioutil.NopCloser(strings.NewReader(body))
+	return resp, nil
+}
+
+func TestLoader_Load(t *testing.T) {
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	client := fakeClient{
+		"https://ex.io/sitemap.xml": "redirect:/sitemap-index.xml",
+		"https://ex.io/sitemap-index.xml": `<sitemapindex>` +
+			`<sitemap><loc>https://ex.io/sitemap-1.xml</loc></sitemap>` +
+			`<sitemap><loc>https://ex.io/sitemap-2.xml.gz</loc></sitemap>` +
+			`<sitemap><loc>https://ex.io/missing.xml</loc></sitemap>` +
+			`<sitemap><loc>https://ex.io/sitemap-index.xml</loc></sitemap>` +
+			`</sitemapindex>`,
+		"https://ex.io/sitemap-1.xml": `<urlset>` +
+			`<url><loc>https://ex.io/a</loc></url>` +
+			`<url><loc>https://ex.io/b</loc></url></urlset>`,
+		"https://ex.io/sitemap-2.xml.gz": gzipped(`<urlset>` +
+			`<url><loc>https://ex.io/b</loc></url>` +
+			`<url><loc>https://ex.io/c</loc></url></urlset>`),
+	}
+
+	got := NewLoader(client, l, true).Load(context.Background(),
+		"https://ex.io/sitemap.xml", "https://ex.io/sitemap-1.xml")
+	want := []string{"https://ex.io/a", "https://ex.io/b", "https://ex.io/c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Loader.Load() = %v, want %v", got, want)
+	}
+}
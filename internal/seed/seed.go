@@ -0,0 +1,65 @@
+// Package seed reads published sitemaps to find urls to crawl
+package seed
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Sitemap is the content of a sitemap file, urls of pages for
+// a urlset or urls of other sitemaps for a sitemap index
+type Sitemap struct {
+	URLs     []string
+	Sitemaps []string
+}
+
+// loc is an url or sitemap entry
+type loc struct {
+	Loc string `xml:"loc"`
+}
+
+// Parse reads a urlset or a sitemap index, gzipped or not
+// At most maxSize bytes of a gzipped sitemap are read once uncompressed
+func Parse(r io.Reader) (*Sitemap, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil &&
+		magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = io.LimitReader(gz, maxSize)
+	} else {
+		r = br
+	}
+
+	var doc struct {
+		XMLName  xml.Name
+		URLs     []loc `xml:"url"`
+		Sitemaps []loc `xml:"sitemap"`
+	}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if n := doc.XMLName.Local; n != "urlset" && n != "sitemapindex" {
+		return nil, fmt.Errorf("%s isn't a sitemap element", n)
+	}
+
+	s := &Sitemap{}
+	for _, u := range doc.URLs {
+		if l := strings.TrimSpace(u.Loc); l != "" {
+			s.URLs = append(s.URLs, l)
+		}
+	}
+	for _, u := range doc.Sitemaps {
+		if l := strings.TrimSpace(u.Loc); l != "" {
+			s.Sitemaps = append(s.Sitemaps, l)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,64 @@
+package seed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const urlset = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"
+  xmlns:image="http://www.google.com/schemas/sitemap-image/1.1">
+  <url><loc> https://ex.io/a </loc><lastmod>2018-08-01</lastmod></url>
+  <url><loc>https://ex.io/b</loc>
+    <image:image><image:loc>https://ex.io/b.png</image:loc></image:image>
+  </url>
+  <url><loc></loc></url>
+</urlset>`
+
+const index = `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://ex.io/sitemap-1.xml</loc></sitemap>
+  <sitemap><loc>https://ex.io/sitemap-2.xml.gz</loc></sitemap>
+</sitemapindex>`
+
+func gzipped(s string) string {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write([]byte(s))
+	w.Close()
+	return b.String()
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    *Sitemap
+		wantErr bool
+	}{
+		{"urlset", urlset,
+			&Sitemap{URLs: []string{"https://ex.io/a", "https://ex.io/b"}},
+			false},
+		{"gzipped urlset", gzipped(urlset),
+			&Sitemap{URLs: []string{"https://ex.io/a", "https://ex.io/b"}},
+			false},
+		{"index", index, &Sitemap{Sitemaps: []string{
+			"https://ex.io/sitemap-1.xml",
+			"https://ex.io/sitemap-2.xml.gz"}}, false},
+		{"html", "<html><body></body></html>", nil, true},
+		{"not xml", "User-agent: *", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
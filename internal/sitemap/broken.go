@@ -0,0 +1,129 @@
+package sitemap
+
+import (
+	"sort"
+
+	"github.com/khrm/smap/internal/linkcheck"
+	"github.com/khrm/smap/internal/parser"
+	"github.com/khrm/smap/internal/redirect"
+)
+
+// BrokenLink is a url which couldn't be got along with
+// the pages linking to it
+type BrokenLink struct {
+	URL    string
+	Status int    `json:",omitempty"`
+	Error  string `json:",omitempty"`
+	// External is set for urls out of the crawl scope
+	External bool `json:",omitempty"`
+	Sources  []Source
+}
+
+// Source is a page leading to a broken url
+type Source struct {
+	Page string
+	// Text is the anchor text of the link
+	Text string `json:",omitempty"`
+	// Type tells how the page leads to the url, i.e. a redirection
+	Type EdgeType `json:",omitempty"`
+}
+
+// SetExternal records the result of the check of url u
+// out of the crawl scope
+func (s *SiteMap) SetExternal(u string, r *linkcheck.Result) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.External == nil {
+		s.External = make(map[string]*linkcheck.Result)
+	}
+	s.External[u] = r
+}
+
+// ExternalLinks gives the urls out of the crawl scope linked
+// from crawled pages, sorted
+func (s *SiteMap) ExternalLinks() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	seen := make(map[string]struct{})
+	var urls []string
+	for _, edges := range s.Connections {
+		for v, e := range edges {
+			if _, ok := seen[v]; ok || e.Type != EdgeExternal {
+				continue
+			}
+			seen[v] = struct{}{}
+			urls = append(urls, v)
+		}
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// BrokenLinks gives the urls answering with a 4xx or 5xx status,
+// redirecting in a loop or through too many hops, or giving no
+// response, i.e. on a dns failure or a timeout, sorted
+// Checked external urls are included
+func (s *SiteMap) BrokenLinks() []BrokenLink {
+	s.Lock()
+	defer s.Unlock()
+
+	var broken []BrokenLink
+	for u, n := range s.URLs {
+		switch {
+		case n.Fetch != nil && n.Fetch.Status >= 400:
+			broken = append(broken, BrokenLink{URL: u,
+				Status: n.Fetch.Status})
+		case n.Fetch != nil && redirectError(n.Fetch) != "":
+			broken = append(broken, BrokenLink{URL: u,
+				Status: n.Fetch.Status, Error: redirectError(n.Fetch)})
+		case n.Fetch == nil && n.Error != "":
+			broken = append(broken, BrokenLink{URL: u, Error: n.Error})
+		}
+	}
+	for u, r := range s.External {
+		if r.Broken() {
+			broken = append(broken, BrokenLink{URL: u, Status: r.Status,
+				Error: r.Error, External: true})
+		}
+	}
+	sort.Slice(broken, func(i, j int) bool {
+		return broken[i].URL < broken[j].URL
+	})
+
+	index := make(map[string]int, len(broken))
+	for i, b := range broken {
+		index[b.URL] = i
+	}
+	for u, edges := range s.Connections {
+		for v, e := range edges {
+			if e.Type == EdgeAlternate {
+				continue
+			}
+			if i, ok := index[v]; ok {
+				broken[i].Sources = append(broken[i].Sources,
+					Source{Page: u, Text: e.Text, Type: e.Type})
+			}
+		}
+	}
+	for _, b := range broken {
+		sort.Slice(b.Sources, func(i, j int) bool {
+			return b.Sources[i].Page < b.Sources[j].Page
+		})
+	}
+	return broken
+}
+
+// redirectError gives why the redirections of f never lead to a page,
+// empty if they do
+func redirectError(f *parser.Fetch) string {
+	switch {
+	case f.Loop:
+		return redirect.ErrLoop.Error()
+	case len(f.Redirects) > 0 && f.FinalURL == "":
+		// Chain was cut before its end
+		return redirect.ErrTooMany.Error()
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+package sitemap
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/khrm/smap/internal/linkcheck"
+	"github.com/khrm/smap/internal/parser"
+)
+
+func TestSiteMap_BrokenLinks(t *testing.T) {
+	s := New()
+	for u, f := range map[string]*parser.Fetch{
+		"https://ex.io":         {Status: 200},
+		"https://ex.io/about":   {Status: 200},
+		"https://ex.io/missing": {Status: 404},
+		"https://ex.io/old":     {Status: 301},
+		"https://ex.io/gone":    {Status: 410},
+		"https://ex.io/error":   {Status: 500},
+		"https://ex.io/timeout": nil,
+		"https://ex.io/later":   nil,
+		"https://ex.io/loop": {Status: 302, Loop: true,
+			FinalURL: "https://ex.io/loop",
+			Redirects: []parser.Redirect{
+				{URL: "https://ex.io/loop", Status: 302},
+				{URL: "https://ex.io/loop/", Status: 302},
+			}},
+		"https://ex.io/chain": {Status: 301,
+			Redirects: []parser.Redirect{
+				{URL: "https://ex.io/chain", Status: 301},
+				{URL: "https://ex.io/chain/1", Status: 301},
+			}},
+		"https://ex.io/moved": {Status: 301,
+			FinalURL: "https://ex.io/about",
+			Redirects: []parser.Redirect{
+				{URL: "https://ex.io/moved", Status: 301},
+			}},
+	} {
+		s.AddURL(u, 1)
+		s.SetFetch(u, f)
+	}
+	s.UpdateNode("https://ex.io/timeout", func(n *Node) {
+		n.Error = "context deadline exceeded"
+	})
+	s.AddEdge("https://ex.io", "https://ex.io/missing",
+		Edge{Text: "Missing"})
+	s.AddEdge("https://ex.io/about", "https://ex.io/missing",
+		Edge{Text: "Also missing"})
+	s.AddEdge("https://ex.io", "https://ex.io/old", Edge{Text: "Old"})
+	s.AddEdge("https://ex.io/old", "https://ex.io/gone",
+		Edge{Type: EdgeRedirect, Status: 301})
+	s.AddEdge("https://ex.io", "https://ex.io/timeout", Edge{})
+	s.AddEdge("https://ex.io", "https://ex.io/about", Edge{})
+	s.AddEdge("https://ex.io/about", "https://ex.io/loop",
+		Edge{Text: "Loop"})
+	s.AddEdge("https://ex.io/about", "https://other.io/404",
+		Edge{Type: EdgeExternal, Text: "Other"})
+	s.AddEdge("https://ex.io/about", "https://other.io",
+		Edge{Type: EdgeExternal})
+	s.SetExternal("https://other.io/404", &linkcheck.Result{Status: 404})
+	s.SetExternal("https://other.io", &linkcheck.Result{Status: 200})
+
+	want := []BrokenLink{
+		{URL: "https://ex.io/chain", Status: 301,
+			Error: "too many redirects"},
+		{URL: "https://ex.io/error", Status: 500},
+		{URL: "https://ex.io/gone", Status: 410, Sources: []Source{
+			{Page: "https://ex.io/old", Type: EdgeRedirect},
+		}},
+		{URL: "https://ex.io/loop", Status: 302, Error: "redirect loop",
+			Sources: []Source{{Page: "https://ex.io/about", Text: "Loop"}}},
+		{URL: "https://ex.io/missing", Status: 404, Sources: []Source{
+			{Page: "https://ex.io", Text: "Missing"},
+			{Page: "https://ex.io/about", Text: "Also missing"},
+		}},
+		{URL: "https://ex.io/timeout", Error: "context deadline exceeded",
+			Sources: []Source{{Page: "https://ex.io"}}},
+		{URL: "https://other.io/404", Status: 404, External: true,
+			Sources: []Source{{Page: "https://ex.io/about", Text: "Other",
+				Type: EdgeExternal}}},
+	}
+	wantExternal := []string{"https://other.io", "https://other.io/404"}
+	if got := s.ExternalLinks(); !reflect.DeepEqual(got, wantExternal) {
+		t.Errorf("SiteMap.ExternalLinks() = %v, want %v", got,
+			wantExternal)
+	}
+	if got := s.BrokenLinks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SiteMap.BrokenLinks() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package sitemap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// errNoJSON is returned by Load when there's no json object to read
+var errNoJSON = errors.New("no json sitemap found")
+
+// Changes are the urls which differ between two crawls
+type Changes struct {
+	// Added are the urls found only by the last crawl and Removed
+	// the ones found only by the previous one
+	Added   []string `json:",omitempty"`
+	Changed []string `json:",omitempty"`
+	Removed []string `json:",omitempty"`
+	// Unchanged is the number of urls found by both crawls
+	// which didn't change
+	Unchanged int
+}
+
+// Load reads a sitemap written as json, i.e. the output of a
+// previous crawl
+// Lines before the one opening the json object, like log lines,
+// are skipped and only the first json value is read
+func Load(r io.Reader) (*SiteMap, error) {
+	br := bufio.NewReader(r)
+	var line []byte
+	for {
+		var err error
+		line, err = br.ReadBytes('\n')
+		if bytes.HasPrefix(bytes.TrimSpace(line), []byte("{")) {
+			break
+		}
+		if err == io.EOF {
+			return nil, errNoJSON
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := New()
+	err := json.NewDecoder(io.MultiReader(bytes.NewReader(line), br)).
+		Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if s.URLs == nil {
+		s.URLs = make(map[string]*Node)
+	}
+	if s.Connections == nil {
+		s.Connections = make(map[string]map[string]Edge)
+	}
+	return s, nil
+}
+
+// Compare sets Changes with the differences between s and prev
+// A url answering 304 is unchanged, otherwise its response
+// details, directives and links are compared
+func (s *SiteMap) Compare(prev *SiteMap) {
+	s.Lock()
+	defer s.Unlock()
+
+	c := &Changes{}
+	for u, n := range s.URLs {
+		p, ok := prev.URLs[u]
+		switch {
+		case !ok:
+			c.Added = append(c.Added, u)
+		case changed(n, p, s.Connections[u], prev.Connections[u]):
+			c.Changed = append(c.Changed, u)
+		default:
+			c.Unchanged++
+		}
+	}
+	for u := range prev.URLs {
+		if _, ok := s.URLs[u]; !ok {
+			c.Removed = append(c.Removed, u)
+		}
+	}
+	sort.Strings(c.Added)
+	sort.Strings(c.Changed)
+	sort.Strings(c.Removed)
+	s.Changes = c
+}
+
+// changed tells whether node n with edges e differs from node p
+// with edges f of a previous crawl
+func changed(n, p *Node, e, f map[string]Edge) bool {
+	if n.Fetch != nil && n.Fetch.NotModified {
+		return false
+	}
+	if !sameLinks(e, f) {
+		return true
+	}
+	if (n.Fetch == nil) != (p.Fetch == nil) {
+		return true
+	}
+	if n.Fetch != nil && (n.Fetch.Status != p.Fetch.Status ||
+		n.Fetch.ETag != p.Fetch.ETag ||
+		n.Fetch.LastModified != p.Fetch.LastModified ||
+		n.Fetch.FinalURL != p.Fetch.FinalURL) {
+		return true
+	}
+	return n.Title != p.Title || n.Modified != p.Modified ||
+		n.Canonical != p.Canonical || n.NoIndex != p.NoIndex ||
+		n.NoFollow != p.NoFollow
+}
+
+// sameLinks tells whether two pages have the same outgoing edges
+func sameLinks(e, f map[string]Edge) bool {
+	if len(e) == 0 && len(f) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(e, f)
+}
@@ -0,0 +1,85 @@
+package sitemap
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/khrm/smap/internal/parser"
+)
+
+func TestLoad(t *testing.T) {
+	want := New()
+	want.AddURL("https://ex.io", 0)
+	want.AddURL("https://ex.io/a", 1)
+	want.SetFetch("https://ex.io", &parser.Fetch{Status: 200, ETag: `"1"`})
+	want.AddConnection("https://ex.io", "https://ex.io/a")
+	data, err := json.MarshalIndent(want, "  ", "    ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Output of smap has log lines before the json sitemap
+	// and the xml one after it
+	got, err := Load(strings.NewReader("logger: main.go:1: crawl" +
+		" interrupted\n" + string(data) +
+		"\nStdSiteMap:\n <urlset></urlset>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+
+	if _, err := Load(strings.NewReader("StdSiteMap:")); err == nil {
+		t.Error("Load() of invalid json gives no error")
+	}
+}
+
+func TestSiteMap_Compare(t *testing.T) {
+	prev := New()
+	s := New()
+	for _, u := range []struct {
+		url        string
+		prev, last *parser.Fetch
+	}{
+		{"https://ex.io", &parser.Fetch{Status: 200, ETag: `"1"`},
+			&parser.Fetch{Status: 200, ETag: `"1"`, NotModified: true}},
+		{"https://ex.io/etag", &parser.Fetch{Status: 200, ETag: `"1"`},
+			&parser.Fetch{Status: 200, ETag: `"2"`}},
+		{"https://ex.io/gone", &parser.Fetch{Status: 200},
+			&parser.Fetch{Status: 404}},
+		{"https://ex.io/links", &parser.Fetch{Status: 200},
+			&parser.Fetch{Status: 200}},
+		{"https://ex.io/same", &parser.Fetch{Status: 200},
+			&parser.Fetch{Status: 200}},
+		{"https://ex.io/removed", &parser.Fetch{Status: 200}, nil},
+		{"https://ex.io/added", nil, &parser.Fetch{Status: 200}},
+	} {
+		if u.prev != nil {
+			prev.AddURL(u.url, 1)
+			prev.SetFetch(u.url, u.prev)
+		}
+		if u.last != nil {
+			s.AddURL(u.url, 1)
+			s.SetFetch(u.url, u.last)
+		}
+	}
+	prev.AddConnection("https://ex.io", "https://ex.io/removed")
+	prev.AddConnection("https://ex.io/links", "https://ex.io/same")
+	s.AddConnection("https://ex.io/links", "https://ex.io/added")
+
+	s.Compare(prev)
+
+	want := &Changes{
+		Added: []string{"https://ex.io/added"},
+		Changed: []string{"https://ex.io/etag", "https://ex.io/gone",
+			"https://ex.io/links"},
+		Removed:   []string{"https://ex.io/removed"},
+		Unchanged: 2,
+	}
+	if !reflect.DeepEqual(s.Changes, want) {
+		t.Errorf("SiteMap.Compare() = %+v, want %+v", s.Changes, want)
+	}
+}
@@ -0,0 +1,475 @@
+package sitemap
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Format is a file format the graph of the sitemap is exported to
+type Format string
+
+// Formats of graph exports
+const (
+	// FormatDOT is the Graphviz format
+	FormatDOT Format = "dot"
+	// FormatGraphML is the GraphML xml format
+	FormatGraphML Format = "graphml"
+	// FormatGEXF is the xml format of Gephi
+	FormatGEXF Format = "gexf"
+	// FormatMermaid is a Mermaid flowchart
+	FormatMermaid Format = "mermaid"
+)
+
+// ErrUnknownFormat is returned for a graph format which isn't supported
+var ErrUnknownFormat = errors.New("unknown graph format")
+
+// ExportConfig tells how the graph of the sitemap is exported
+type ExportConfig struct {
+	// ClusterDepth groups urls by host and the first ClusterDepth
+	// segments of their path, i.e. ex.io/docs for 1, 0 disables it
+	ClusterDepth int
+}
+
+// graphNode is a url of the exported graph
+type graphNode struct {
+	id      string
+	url     string
+	status  int
+	depth   int
+	title   string
+	cluster string
+}
+
+// graphEdge is a connection between two nodes of the exported graph
+type graphEdge struct {
+	source, target *graphNode
+	typ            string
+}
+
+// graph is the sitemap as exported, nodes and edges are sorted
+// by url so that exports are the same between runs
+type graph struct {
+	nodes []*graphNode
+	edges []graphEdge
+	// clusters are the names of the clusters in order
+	clusters []string
+}
+
+// Export writes the graph of urls and connections of the sitemap
+// to w in format f
+// Nodes have the status, the depth and the title of their url
+// Connections to urls which aren't in the sitemap, like external
+// ones, are left out
+func (s *SiteMap) Export(w io.Writer, f Format, c *ExportConfig) error {
+	if c == nil {
+		c = &ExportConfig{}
+	}
+	g := s.graph(c.ClusterDepth)
+	switch f {
+	case FormatDOT:
+		return g.writeDOT(w)
+	case FormatGraphML:
+		return g.writeGraphML(w)
+	case FormatGEXF:
+		return g.writeGEXF(w)
+	case FormatMermaid:
+		return g.writeMermaid(w)
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownFormat, f)
+}
+
+// graph gives the graph of the sitemap, nodes are clustered by
+// the first clusterDepth segments of their path if it's not 0
+func (s *SiteMap) graph(clusterDepth int) *graph {
+	s.Lock()
+	defer s.Unlock()
+
+	urls := make([]string, 0, len(s.URLs))
+	for u := range s.URLs {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	g := &graph{}
+	nodes := make(map[string]*graphNode, len(urls))
+	seen := make(map[string]struct{})
+	for i, u := range urls {
+		n := s.URLs[u]
+		gn := &graphNode{id: fmt.Sprintf("n%d", i), url: u,
+			depth: n.Depth, title: n.Title}
+		if n.Fetch != nil {
+			gn.status = n.Fetch.Status
+		}
+		if clusterDepth > 0 {
+			gn.cluster = cluster(u, clusterDepth)
+			if _, ok := seen[gn.cluster]; !ok {
+				seen[gn.cluster] = struct{}{}
+				g.clusters = append(g.clusters, gn.cluster)
+			}
+		}
+		nodes[u] = gn
+		g.nodes = append(g.nodes, gn)
+	}
+	sort.Strings(g.clusters)
+
+	for _, u := range urls {
+		targets := make([]string, 0, len(s.Connections[u]))
+		for v := range s.Connections[u] {
+			if _, ok := nodes[v]; ok {
+				targets = append(targets, v)
+			}
+		}
+		sort.Strings(targets)
+		for _, v := range targets {
+			typ := string(s.Connections[u][v].Type)
+			if typ == "" {
+				typ = "link"
+			}
+			g.edges = append(g.edges, graphEdge{source: nodes[u],
+				target: nodes[v], typ: typ})
+		}
+	}
+	return g
+}
+
+// cluster gives the host of u along with the first depth segments
+// of its path
+func cluster(u string, depth int) string {
+	p, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	segments := strings.Split(strings.Trim(p.Path, "/"), "/")
+	if segments[0] == "" {
+		return p.Host + "/"
+	}
+	if len(segments) > depth {
+		segments = segments[:depth]
+	}
+	return p.Host + "/" + strings.Join(segments, "/")
+}
+
+// clustered gives the nodes of every cluster, in the order of clusters
+func (g *graph) clustered() [][]*graphNode {
+	if len(g.clusters) == 0 {
+		return nil
+	}
+	index := make(map[string]int, len(g.clusters))
+	for i, c := range g.clusters {
+		index[c] = i
+	}
+	nodes := make([][]*graphNode, len(g.clusters))
+	for _, n := range g.nodes {
+		i := index[n.cluster]
+		nodes[i] = append(nodes[i], n)
+	}
+	return nodes
+}
+
+// label gives the text shown for node n, its title or else its url
+func (n *graphNode) label() string {
+	if n.title != "" {
+		return n.title
+	}
+	return n.url
+}
+
+// writeDOT writes the graph in the Graphviz format, clusters are
+// subgraphs whose names start with cluster as dot requires
+func (g *graph) writeDOT(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "digraph sitemap {")
+	fmt.Fprintln(b, "\tnode [shape=box];")
+	for i, nodes := range g.clustered() {
+		if g.clusters[i] == "" {
+			for _, n := range nodes {
+				writeDOTNode(b, "\t", n)
+			}
+			continue
+		}
+		fmt.Fprintf(b, "\tsubgraph cluster_%d {\n", i)
+		fmt.Fprintf(b, "\t\tlabel=%s;\n", dotQuote(g.clusters[i]))
+		for _, n := range nodes {
+			writeDOTNode(b, "\t\t", n)
+		}
+		fmt.Fprintln(b, "\t}")
+	}
+	if len(g.clusters) == 0 {
+		for _, n := range g.nodes {
+			writeDOTNode(b, "\t", n)
+		}
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(b, "\t%s -> %s [type=%s", e.source.id, e.target.id,
+			dotQuote(e.typ))
+		if e.typ != "link" {
+			fmt.Fprintf(b, ", style=dashed, label=%s", dotQuote(e.typ))
+		}
+		fmt.Fprintln(b, "];")
+	}
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
+
+// writeDOTNode writes the statement of node n indented with indent
+func writeDOTNode(w io.Writer, indent string, n *graphNode) {
+	fmt.Fprintf(w, "%s%s [label=%s, URL=%s, depth=%d", indent, n.id,
+		dotQuote(n.label()), dotQuote(n.url), n.depth)
+	if n.status != 0 {
+		fmt.Fprintf(w, ", status=%d", n.status)
+	}
+	if n.title != "" {
+		fmt.Fprintf(w, ", title=%s", dotQuote(n.title))
+	}
+	fmt.Fprintln(w, "];")
+}
+
+// dotQuote gives s as a double quoted dot string
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "")
+	return `"` + r.Replace(s) + `"`
+}
+
+// graphmlData is the value of attribute Key of a node or an edge
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphmlKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphmlNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphmlData `xml:"data"`
+}
+
+// writeGraphML writes the graph in the GraphML format, the cluster
+// of nodes is one of their attributes
+func (g *graph) writeGraphML(w io.Writer) error {
+	type graph struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphmlNode `xml:"node"`
+		Edges       []graphmlEdge `xml:"edge"`
+	}
+	doc := struct {
+		XMLName xml.Name     `xml:"graphml"`
+		XMLNS   string       `xml:"xmlns,attr"`
+		Keys    []graphmlKey `xml:"key"`
+		Graph   graph        `xml:"graph"`
+	}{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphmlKey{
+			{ID: "url", For: "node", Name: "url", Type: "string"},
+			{ID: "status", For: "node", Name: "status", Type: "int"},
+			{ID: "depth", For: "node", Name: "depth", Type: "int"},
+			{ID: "title", For: "node", Name: "title", Type: "string"},
+			{ID: "cluster", For: "node", Name: "cluster", Type: "string"},
+			{ID: "type", For: "edge", Name: "type", Type: "string"},
+		},
+		Graph: graph{ID: "sitemap", EdgeDefault: "directed"},
+	}
+	for _, n := range g.nodes {
+		data := []graphmlData{{"url", n.url}}
+		if n.status != 0 {
+			data = append(data, graphmlData{"status", strconv.Itoa(n.status)})
+		}
+		data = append(data, graphmlData{"depth", strconv.Itoa(n.depth)})
+		if n.title != "" {
+			data = append(data, graphmlData{"title", n.title})
+		}
+		if n.cluster != "" {
+			data = append(data, graphmlData{"cluster", n.cluster})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes,
+			graphmlNode{ID: n.id, Data: data})
+	}
+	for i, e := range g.edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphmlEdge{
+			ID:     fmt.Sprintf("e%d", i),
+			Source: e.source.id,
+			Target: e.target.id,
+			Data:   []graphmlData{{"type", e.typ}},
+		})
+	}
+	return writeXML(w, doc)
+}
+
+// gexf attributes of nodes, their ids are their index
+var gexfNodeAttributes = []gexfAttribute{
+	{ID: "0", Title: "url", Type: "string"},
+	{ID: "1", Title: "status", Type: "integer"},
+	{ID: "2", Title: "depth", Type: "integer"},
+	{ID: "3", Title: "title", Type: "string"},
+	{ID: "4", Title: "cluster", Type: "string"},
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type gexfNode struct {
+	ID     string      `xml:"id,attr"`
+	Label  string      `xml:"label,attr"`
+	Values []gexfValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID     string      `xml:"id,attr"`
+	Source string      `xml:"source,attr"`
+	Target string      `xml:"target,attr"`
+	Values []gexfValue `xml:"attvalues>attvalue"`
+}
+
+// writeGEXF writes the graph in the GEXF format read by Gephi, the
+// cluster of nodes is one of their attributes
+func (g *graph) writeGEXF(w io.Writer) error {
+	type graph struct {
+		DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+		Attributes      []gexfAttributes `xml:"attributes"`
+		Nodes           []gexfNode       `xml:"nodes>node"`
+		Edges           []gexfEdge       `xml:"edges>edge"`
+	}
+	doc := struct {
+		XMLName xml.Name `xml:"gexf"`
+		XMLNS   string   `xml:"xmlns,attr"`
+		Version string   `xml:"version,attr"`
+		Graph   graph    `xml:"graph"`
+	}{
+		XMLNS:   "http://www.gexf.net/1.2draft",
+		Version: "1.2",
+		Graph: graph{
+			DefaultEdgeType: "directed",
+			Attributes: []gexfAttributes{
+				{Class: "node", Attributes: gexfNodeAttributes},
+				{Class: "edge", Attributes: []gexfAttribute{
+					{ID: "0", Title: "type", Type: "string"}}},
+			},
+		},
+	}
+	for _, n := range g.nodes {
+		values := []gexfValue{{"0", n.url}}
+		if n.status != 0 {
+			values = append(values, gexfValue{"1", strconv.Itoa(n.status)})
+		}
+		values = append(values, gexfValue{"2", strconv.Itoa(n.depth)})
+		if n.title != "" {
+			values = append(values, gexfValue{"3", n.title})
+		}
+		if n.cluster != "" {
+			values = append(values, gexfValue{"4", n.cluster})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes,
+			gexfNode{ID: n.id, Label: n.label(), Values: values})
+	}
+	for i, e := range g.edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{
+			ID:     fmt.Sprintf("e%d", i),
+			Source: e.source.id,
+			Target: e.target.id,
+			Values: []gexfValue{{"0", e.typ}},
+		})
+	}
+	return writeXML(w, doc)
+}
+
+// writeXML writes the xml document of v to w
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	if err := e.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeMermaid writes the graph as a Mermaid flowchart, clusters are
+// subgraphs and nodes show their title, status and depth
+func (g *graph) writeMermaid(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "flowchart LR")
+	for i, nodes := range g.clustered() {
+		if g.clusters[i] == "" {
+			for _, n := range nodes {
+				writeMermaidNode(b, "    ", n)
+			}
+			continue
+		}
+		fmt.Fprintf(b, "    subgraph c%d [%s]\n", i,
+			mermaidQuote(g.clusters[i]))
+		for _, n := range nodes {
+			writeMermaidNode(b, "        ", n)
+		}
+		fmt.Fprintln(b, "    end")
+	}
+	if len(g.clusters) == 0 {
+		for _, n := range g.nodes {
+			writeMermaidNode(b, "    ", n)
+		}
+	}
+	for _, e := range g.edges {
+		if e.typ == "link" {
+			fmt.Fprintf(b, "    %s --> %s\n", e.source.id, e.target.id)
+			continue
+		}
+		fmt.Fprintf(b, "    %s -.->|%s| %s\n", e.source.id, e.typ,
+			e.target.id)
+	}
+	return b.Flush()
+}
+
+// writeMermaidNode writes the declaration of node n indented
+// with indent
+func writeMermaidNode(w io.Writer, indent string, n *graphNode) {
+	details := fmt.Sprintf("depth %d", n.depth)
+	if n.status != 0 {
+		details = fmt.Sprintf("%d, %s", n.status, details)
+	}
+	fmt.Fprintf(w, "%s%s[%s]\n", indent, n.id,
+		mermaidQuote(n.label()+"\n"+details))
+	fmt.Fprintf(w, "%sclick %s \"%s\"\n", indent, n.id,
+		strings.ReplaceAll(n.url, `"`, "%22"))
+}
+
+// mermaidQuote gives s as a double quoted mermaid string, characters
+// which have a meaning in labels are written as entity codes
+func mermaidQuote(s string) string {
+	r := strings.NewReplacer("#", "#35;", `"`, "#quot;", "<", "#lt;",
+		">", "#gt;", "\n", "<br/>", "\r", "")
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,168 @@
+package sitemap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/khrm/smap/internal/parser"
+)
+
+func TestSiteMap_Export(t *testing.T) {
+	s := New()
+	s.AddURL("https://ex.io", 0)
+	s.AddURL("https://ex.io/docs/a", 1)
+	s.AddURL("https://ex.io/old", 1)
+	s.SetFetch("https://ex.io", &parser.Fetch{Status: 200})
+	s.SetFetch("https://ex.io/docs/a", &parser.Fetch{Status: 404})
+	s.SetFetch("https://ex.io/old", &parser.Fetch{Status: 301})
+	s.UpdateNode("https://ex.io", func(n *Node) {
+		n.Title = `Home "#1" <ex>`
+	})
+	s.AddConnection("https://ex.io", "https://ex.io/docs/a")
+	s.AddConnection("https://ex.io", "https://ex.io/old")
+	s.AddEdge("https://ex.io/old", "https://ex.io/docs/a",
+		Edge{Type: EdgeRedirect, Status: 301})
+	s.AddEdge("https://ex.io", "https://other.io", Edge{Type: EdgeExternal})
+
+	tests := []struct {
+		name string
+		f    Format
+		c    *ExportConfig
+		// want is the whole export, or else parts of it
+		want     string
+		contains []string
+	}{
+		{
+			name: "dot",
+			f:    FormatDOT,
+			want: `digraph sitemap {
+	node [shape=box];
+	n0 [label="Home \"#1\" <ex>", URL="https://ex.io", depth=0, status=200, title="Home \"#1\" <ex>"];
+	n1 [label="https://ex.io/docs/a", URL="https://ex.io/docs/a", depth=1, status=404];
+	n2 [label="https://ex.io/old", URL="https://ex.io/old", depth=1, status=301];
+	n0 -> n1 [type="link"];
+	n0 -> n2 [type="link"];
+	n2 -> n1 [type="redirect", style=dashed, label="redirect"];
+}
+`,
+		},
+		{
+			name: "dot clusters",
+			f:    FormatDOT,
+			c:    &ExportConfig{ClusterDepth: 1},
+			want: `digraph sitemap {
+	node [shape=box];
+	subgraph cluster_0 {
+		label="ex.io/";
+		n0 [label="Home \"#1\" <ex>", URL="https://ex.io", depth=0, status=200, title="Home \"#1\" <ex>"];
+	}
+	subgraph cluster_1 {
+		label="ex.io/docs";
+		n1 [label="https://ex.io/docs/a", URL="https://ex.io/docs/a", depth=1, status=404];
+	}
+	subgraph cluster_2 {
+		label="ex.io/old";
+		n2 [label="https://ex.io/old", URL="https://ex.io/old", depth=1, status=301];
+	}
+	n0 -> n1 [type="link"];
+	n0 -> n2 [type="link"];
+	n2 -> n1 [type="redirect", style=dashed, label="redirect"];
+}
+`,
+		},
+		{
+			name: "mermaid clusters",
+			f:    FormatMermaid,
+			c:    &ExportConfig{ClusterDepth: 2},
+			want: `flowchart LR
+    subgraph c0 ["ex.io/"]
+        n0["Home #quot;#35;1#quot; #lt;ex#gt;<br/>200, depth 0"]
+        click n0 "https://ex.io"
+    end
+    subgraph c1 ["ex.io/docs/a"]
+        n1["https://ex.io/docs/a<br/>404, depth 1"]
+        click n1 "https://ex.io/docs/a"
+    end
+    subgraph c2 ["ex.io/old"]
+        n2["https://ex.io/old<br/>301, depth 1"]
+        click n2 "https://ex.io/old"
+    end
+    n0 --> n1
+    n0 --> n2
+    n2 -.->|redirect| n1
+`,
+		},
+		{
+			name: "graphml",
+			f:    FormatGraphML,
+			c:    &ExportConfig{ClusterDepth: 1},
+			contains: []string{
+				`<key id="status" for="node" attr.name="status" attr.type="int">`,
+				`<graph id="sitemap" edgedefault="directed">`,
+				`<node id="n1">
+      <data key="url">https://ex.io/docs/a</data>
+      <data key="status">404</data>
+      <data key="depth">1</data>
+      <data key="cluster">ex.io/docs</data>
+    </node>`,
+				`<data key="title">Home &#34;#1&#34; &lt;ex&gt;</data>`,
+				`<edge id="e2" source="n2" target="n1">
+      <data key="type">redirect</data>
+    </edge>`,
+			},
+		},
+		{
+			name: "gexf",
+			f:    FormatGEXF,
+			contains: []string{
+				`<gexf xmlns="http://www.gexf.net/1.2draft" version="1.2">`,
+				`<attribute id="1" title="status" type="integer">`,
+				`<node id="n0" label="Home &#34;#1&#34; &lt;ex&gt;">`,
+				`<attvalue for="1" value="404"></attvalue>`,
+				`<edge id="e2" source="n2" target="n1">
+        <attvalues>
+          <attvalue for="0" value="redirect"></attvalue>`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := s.Export(&b, tt.f, tt.c); err != nil {
+				t.Fatalf("SiteMap.Export() error = %v", err)
+			}
+			got := b.String()
+			if tt.want != "" && got != tt.want {
+				t.Errorf("SiteMap.Export() = %s, want %s", got, tt.want)
+			}
+			for _, c := range tt.contains {
+				if !strings.Contains(got, c) {
+					t.Errorf("SiteMap.Export() = %s, want it to contain %s",
+						got, c)
+				}
+			}
+			if tt.contains != nil {
+				d := xml.NewDecoder(&b)
+				for {
+					_, err := d.Token()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatalf("SiteMap.Export() isn't valid xml: %v", err)
+					}
+				}
+			}
+		})
+	}
+
+	var b bytes.Buffer
+	if err := s.Export(&b, "png", nil); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("SiteMap.Export(png) error = %v, want %v", err,
+			ErrUnknownFormat)
+	}
+}
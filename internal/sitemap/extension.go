@@ -0,0 +1,171 @@
+package sitemap
+
+import (
+	"encoding/xml"
+)
+
+// Namespaces of the sitemap extensions
+const (
+	imageNS = "http://www.google.com/schemas/sitemap-image/1.1"
+	videoNS = "http://www.google.com/schemas/sitemap-video/1.1"
+	newsNS  = "http://www.google.com/schemas/sitemap-news/0.9"
+	xhtmlNS = "http://www.w3.org/1999/xhtml"
+)
+
+// maxImages is the maximum number of images of an url entry
+const maxImages = 1000
+
+// xmlImage is an image:image entry
+type xmlImage struct {
+	Loc     string `xml:"image:loc"`
+	Caption string `xml:"image:caption,omitempty"`
+}
+
+// xmlVideo is a video:video entry
+type xmlVideo struct {
+	ThumbnailLoc string `xml:"video:thumbnail_loc"`
+	Title        string `xml:"video:title"`
+	Description  string `xml:"video:description"`
+	ContentLoc   string `xml:"video:content_loc,omitempty"`
+	PlayerLoc    string `xml:"video:player_loc,omitempty"`
+	Duration     int    `xml:"video:duration,omitempty"`
+}
+
+// xmlNews is a news:news entry
+type xmlNews struct {
+	Name            string `xml:"news:publication>news:name"`
+	Language        string `xml:"news:publication>news:language"`
+	PublicationDate string `xml:"news:publication_date"`
+	Title           string `xml:"news:title"`
+}
+
+// xmlLink is a xhtml:link entry giving an alternate of the url
+type xmlLink struct {
+	Rel      string `xml:"rel,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+// extensions tells which sitemap extensions are used by url entries
+type extensions struct {
+	image, video, news, xhtml bool
+}
+
+// add records the extensions used by u
+func (e *extensions) add(u xmlURL) {
+	e.image = e.image || len(u.Images) > 0
+	e.video = e.video || len(u.Videos) > 0
+	e.news = e.news || u.News != nil
+	e.xhtml = e.xhtml || len(u.Alternates) > 0
+}
+
+// xmlURLSet is the root element of a sitemap
+type xmlURLSet struct {
+	XMLName   xml.Name `xml:"urlset"`
+	XMLnsAttr string   `xml:"xmlns,attr"`
+	ImageNS   string   `xml:"xmlns:image,attr,omitempty"`
+	VideoNS   string   `xml:"xmlns:video,attr,omitempty"`
+	NewsNS    string   `xml:"xmlns:news,attr,omitempty"`
+	XhtmlNS   string   `xml:"xmlns:xhtml,attr,omitempty"`
+	URL       []xmlURL `xml:"url"`
+}
+
+// newURLSet gives the urlset of urls declaring the namespaces
+// of extensions e
+func newURLSet(urls []xmlURL, e extensions) *xmlURLSet {
+	s := &xmlURLSet{XMLnsAttr: sitemapNS, URL: urls}
+	if e.image {
+		s.ImageNS = imageNS
+	}
+	if e.video {
+		s.VideoNS = videoNS
+	}
+	if e.news {
+		s.NewsNS = newsNS
+	}
+	if e.xhtml {
+		s.XhtmlNS = xhtmlNS
+	}
+	return s
+}
+
+// images gives the image entries of n
+func (c *XMLConfig) images(n *Node) []xmlImage {
+	if !c.Images {
+		return nil
+	}
+	var images []xmlImage
+	seen := map[string]struct{}{}
+	for _, i := range n.Images {
+		if _, ok := seen[i.URL]; ok || len(images) == maxImages {
+			continue
+		}
+		seen[i.URL] = struct{}{}
+		images = append(images, xmlImage{Loc: i.URL, Caption: i.Alt})
+	}
+	return images
+}
+
+// videos gives the video entries of n, videos missing a field
+// required by the protocol are left out
+func (c *XMLConfig) videos(n *Node) []xmlVideo {
+	if !c.Videos {
+		return nil
+	}
+	var videos []xmlVideo
+	for _, v := range n.Videos {
+		if v.ThumbnailURL == "" || v.Title == "" || v.Description == "" ||
+			(v.ContentURL == "" && v.PlayerURL == "") {
+			continue
+		}
+		videos = append(videos, xmlVideo{
+			ThumbnailLoc: v.ThumbnailURL,
+			Title:        v.Title,
+			Description:  v.Description,
+			ContentLoc:   v.ContentURL,
+			PlayerLoc:    v.PlayerURL,
+			Duration:     v.Duration,
+		})
+	}
+	return videos
+}
+
+// news gives the news entry of n, nil if it isn't an article or
+// misses a field required by the protocol
+func (c *XMLConfig) news(n *Node) *xmlNews {
+	if !c.News || n.News == nil {
+		return nil
+	}
+	x := &xmlNews{
+		Name:            n.News.Publication,
+		Language:        n.News.Language,
+		PublicationDate: w3cDate(n.News.Published),
+		Title:           n.News.Title,
+	}
+	if x.Name == "" {
+		x.Name = c.NewsPublication
+	}
+	if x.Name == "" || x.Language == "" || x.PublicationDate == "" ||
+		x.Title == "" {
+		return nil
+	}
+	return x
+}
+
+// alternates gives the xhtml:link entries of url u, languages
+// with an invalid code are left out
+func (c *XMLConfig) alternates(s *SiteMap, u string) []xmlLink {
+	if !c.Alternates {
+		return nil
+	}
+	var links []xmlLink
+	alts := s.Alternates[u]
+	for _, lang := range sortedLangs(alts) {
+		if !ValidHreflang(lang) {
+			continue
+		}
+		links = append(links, xmlLink{Rel: "alternate", Hreflang: lang,
+			Href: alts[lang]})
+	}
+	return links
+}
@@ -0,0 +1,86 @@
+package sitemap
+
+import (
+	"testing"
+
+	"github.com/khrm/smap/internal/parser"
+)
+
+func TestSiteMap_ToXMLSTDSiteMapExtensions(t *testing.T) {
+	s := &SiteMap{URLs: map[string]*Node{
+		"https://ex.io": {Images: []parser.Image{
+			{URL: "https://ex.io/a.png", Alt: "A"},
+			{URL: "https://ex.io/a.png"},
+			{URL: "https://cdn.io/b.png"}}},
+		"https://ex.io/video": {Videos: []parser.Video{
+			{ContentURL: "https://ex.io/v.mp4", Title: "V",
+				Description: "About v", ThumbnailURL: "https://ex.io/v.jpg",
+				Duration: 60},
+			{ContentURL: "https://ex.io/no-thumbnail.mp4", Title: "W",
+				Description: "W"}}},
+		"https://ex.io/news": {News: &parser.News{Language: "en",
+			Published: "2018-08-07T10:00:00+02:00", Title: "N"}},
+	}}
+
+	tests := []struct {
+		name   string
+		config *XMLConfig
+		want   string
+	}{
+		{
+			name:   "no extension",
+			config: nil,
+			want: `<urlset xmlns="https://www.sitemaps.org/schemas/sitemap/0.9">` +
+				`<url><loc>https://ex.io</loc></url>` +
+				`<url><loc>https://ex.io/news</loc></url>` +
+				`<url><loc>https://ex.io/video</loc></url></urlset>`,
+		},
+		{
+			name: "all extensions",
+			config: &XMLConfig{Images: true, Videos: true, News: true,
+				NewsPublication: "Ex"},
+			want: `<urlset xmlns="https://www.sitemaps.org/schemas/sitemap/0.9"` +
+				` xmlns:image="http://www.google.com/schemas/sitemap-image/1.1"` +
+				` xmlns:video="http://www.google.com/schemas/sitemap-video/1.1"` +
+				` xmlns:news="http://www.google.com/schemas/sitemap-news/0.9">` +
+				`<url><loc>https://ex.io</loc>` +
+				`<image:image><image:loc>https://ex.io/a.png</image:loc>` +
+				`<image:caption>A</image:caption></image:image>` +
+				`<image:image><image:loc>https://cdn.io/b.png</image:loc>` +
+				`</image:image></url>` +
+				`<url><loc>https://ex.io/news</loc><news:news>` +
+				`<news:publication><news:name>Ex</news:name>` +
+				`<news:language>en</news:language></news:publication>` +
+				`<news:publication_date>2018-08-07T10:00:00+02:00` +
+				`</news:publication_date><news:title>N</news:title>` +
+				`</news:news></url>` +
+				`<url><loc>https://ex.io/video</loc><video:video>` +
+				`<video:thumbnail_loc>https://ex.io/v.jpg</video:thumbnail_loc>` +
+				`<video:title>V</video:title>` +
+				`<video:description>About v</video:description>` +
+				`<video:content_loc>https://ex.io/v.mp4</video:content_loc>` +
+				`<video:duration>60</video:duration></video:video></url>` +
+				`</urlset>`,
+		},
+		{
+			name:   "news without publication",
+			config: &XMLConfig{News: true},
+			want: `<urlset xmlns="https://www.sitemaps.org/schemas/sitemap/0.9">` +
+				`<url><loc>https://ex.io</loc></url>` +
+				`<url><loc>https://ex.io/news</loc></url>` +
+				`<url><loc>https://ex.io/video</loc></url></urlset>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ToXMLSTDSiteMapConfig(tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("SiteMap.ToXMLSTDSiteMapConfig() = \n%s, want \n%s",
+					got, tt.want)
+			}
+		})
+	}
+}
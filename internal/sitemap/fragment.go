@@ -0,0 +1,104 @@
+package sitemap
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxRedirectHops is the number of redirections followed to find
+// the page holding the target of a fragment
+const maxRedirectHops = 10
+
+// BrokenFragment is a link to a fragment which isn't an anchor
+// of its target page
+type BrokenFragment struct {
+	// Page is the page of the link and URL its target
+	Page     string
+	URL      string
+	Fragment string
+	// Text is the anchor text of the link
+	Text string `json:",omitempty"`
+}
+
+// BrokenFragments gives the links whose fragment isn't an anchor of
+// the page they lead to, once redirections are followed, sorted
+// Only links to html pages which were got are checked, fragments
+// which don't target anchors like #top, #/route or #:~:text= are ignored
+func (s *SiteMap) BrokenFragments() []BrokenFragment {
+	s.Lock()
+	defer s.Unlock()
+
+	var broken []BrokenFragment
+	for u, edges := range s.Connections {
+		for v, e := range edges {
+			if e.Type != EdgeLink || len(e.Fragments) == 0 {
+				continue
+			}
+			n, ok := s.URLs[s.final(v)]
+			if !ok || n.Fetch == nil || n.Fetch.Status != 200 ||
+				!strings.HasPrefix(n.Fetch.ContentType, "text/html") {
+				continue
+			}
+			for f, text := range e.Fragments {
+				if anchorFragment(f) && !contains(n.Anchors, f) {
+					broken = append(broken, BrokenFragment{Page: u, URL: v,
+						Fragment: f, Text: text})
+				}
+			}
+		}
+	}
+	sort.Slice(broken, func(i, j int) bool {
+		a, b := broken[i], broken[j]
+		if a.Page != b.Page {
+			return a.Page < b.Page
+		}
+		if a.URL != b.URL {
+			return a.URL < b.URL
+		}
+		return a.Fragment < b.Fragment
+	})
+	return broken
+}
+
+// final gives the url where the redirections from u end
+func (s *SiteMap) final(u string) string {
+	for i := 0; i < maxRedirectHops; i++ {
+		n, ok := s.URLs[u]
+		if !ok || !n.Redirected() {
+			return u
+		}
+		next := ""
+		for v, e := range s.Connections[u] {
+			if e.Type == EdgeRedirect {
+				next = v
+				break
+			}
+		}
+		if next == "" {
+			return u
+		}
+		u = next
+	}
+	return u
+}
+
+// anchorFragment tells whether fragment f targets an anchor of
+// the page, #top always exists and #/route, #!route or #:~:text=
+// are used by scripts and browsers
+func anchorFragment(f string) bool {
+	if f == "" || strings.EqualFold(f, "top") {
+		return false
+	}
+	return !strings.HasPrefix(f, "/") && !strings.HasPrefix(f, "!") &&
+		!strings.HasPrefix(f, ":~:")
+}
+
+// contains tells whether s is one of list
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package sitemap
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/khrm/smap/internal/parser"
+)
+
+func TestSiteMap_BrokenFragments(t *testing.T) {
+	s := New()
+	html := &parser.Fetch{Status: 200, ContentType: "text/html; charset=utf-8"}
+	for u, f := range map[string]*parser.Fetch{
+		"https://ex.io":      html,
+		"https://ex.io/docs": html,
+		"https://ex.io/old":  {Status: 301},
+		"https://ex.io/pdf":  {Status: 200, ContentType: "application/pdf"},
+		"https://ex.io/404":  {Status: 404, ContentType: "text/html"},
+		"https://ex.io/deep": nil,
+	} {
+		s.AddURL(u, 1)
+		s.SetFetch(u, f)
+	}
+	s.UpdateNode("https://ex.io/docs", func(n *Node) {
+		n.Anchors = []string{"install", "Setup"}
+	})
+	s.AddEdge("https://ex.io/old", "https://ex.io/docs",
+		Edge{Type: EdgeRedirect, Status: 301})
+	frag := func(text string, fs ...string) Edge {
+		e := Edge{Text: text, Fragments: map[string]string{}}
+		for _, f := range fs {
+			e.Fragments[f] = text
+		}
+		return e
+	}
+	s.AddEdge("https://ex.io", "https://ex.io/docs",
+		frag("Docs", "install", "setup", "top", "/route", "!bang",
+			":~:text=install"))
+	s.AddEdge("https://ex.io", "https://ex.io/old", frag("Old", "gone"))
+	s.AddEdge("https://ex.io", "https://ex.io/pdf", frag("", "page=2"))
+	s.AddEdge("https://ex.io", "https://ex.io/404", frag("", "x"))
+	s.AddEdge("https://ex.io", "https://ex.io/deep", frag("", "x"))
+	s.AddEdge("https://ex.io", "https://other.io", Edge{Type: EdgeExternal,
+		Fragments: map[string]string{"x": ""}})
+
+	want := []BrokenFragment{
+		{Page: "https://ex.io", URL: "https://ex.io/docs",
+			Fragment: "setup", Text: "Docs"},
+		{Page: "https://ex.io", URL: "https://ex.io/old",
+			Fragment: "gone", Text: "Old"},
+	}
+	if got := s.BrokenFragments(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SiteMap.BrokenFragments() = %+v, want %+v", got, want)
+	}
+}
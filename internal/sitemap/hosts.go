@@ -0,0 +1,81 @@
+package sitemap
+
+import (
+	"net/url"
+)
+
+// HostSummary contains the figures of the urls of a host
+type HostSummary struct {
+	URLs int
+	// Errors are the urls answering with a 4xx or 5xx status
+	Errors    int `json:",omitempty"`
+	Redirects int `json:",omitempty"`
+	NoIndex   int `json:",omitempty"`
+	Orphans   int `json:",omitempty"`
+	Skipped   int `json:",omitempty"`
+	MaxDepth  int
+	// Links are the links between pages of the host and CrossLinks
+	// the links from its pages to other hosts
+	Links      int `json:",omitempty"`
+	CrossLinks int `json:",omitempty"`
+}
+
+// Summarize sets Hosts with the figures of every host of the sitemap
+func (s *SiteMap) Summarize() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.Hosts = make(map[string]*HostSummary)
+	summary := func(u string) *HostSummary {
+		h := host(u)
+		if _, ok := s.Hosts[h]; !ok {
+			s.Hosts[h] = &HostSummary{}
+		}
+		return s.Hosts[h]
+	}
+
+	for u, n := range s.URLs {
+		hs := summary(u)
+		hs.URLs++
+		switch {
+		case n.Redirected():
+			hs.Redirects++
+		case n.Fetch != nil && n.Fetch.Status >= 400:
+			hs.Errors++
+		}
+		if n.NoIndex {
+			hs.NoIndex++
+		}
+		if n.Orphan {
+			hs.Orphans++
+		}
+		if n.Depth > hs.MaxDepth {
+			hs.MaxDepth = n.Depth
+		}
+	}
+	for u := range s.Skipped {
+		summary(u).Skipped++
+	}
+	for u, edges := range s.Connections {
+		hs := summary(u)
+		for v, e := range edges {
+			if e.Type != EdgeLink {
+				continue
+			}
+			if host(v) == host(u) {
+				hs.Links++
+			} else {
+				hs.CrossLinks++
+			}
+		}
+	}
+}
+
+// host gives the host of url u
+func host(u string) string {
+	p, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return p.Host
+}
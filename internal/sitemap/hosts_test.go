@@ -0,0 +1,42 @@
+package sitemap
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/khrm/smap/internal/parser"
+)
+
+func TestSiteMap_Summarize(t *testing.T) {
+	s := New()
+	for u, n := range map[string]*Node{
+		"https://www.ex.io":     {},
+		"https://www.ex.io/a":   {Depth: 1, NoIndex: true},
+		"https://www.ex.io/old": {Depth: 1, Fetch: &parser.Fetch{Status: 301}},
+		"https://docs.ex.io":    {Depth: 1},
+		"https://docs.ex.io/x":  {Depth: 3, Fetch: &parser.Fetch{Status: 404}},
+		"https://docs.ex.io/o":  {Orphan: true},
+	} {
+		s.URLs[u] = n
+	}
+	s.AddConnection("https://www.ex.io", "https://www.ex.io/a")
+	s.AddConnection("https://www.ex.io", "https://docs.ex.io")
+	s.AddEdge("https://www.ex.io/old", "https://www.ex.io",
+		Edge{Type: EdgeRedirect, Status: 301})
+	s.AddConnection("https://docs.ex.io", "https://docs.ex.io/x")
+	s.AddSkipped("https://docs.ex.io/admin", "blocked by robots")
+
+	s.Summarize()
+
+	want := map[string]*HostSummary{
+		"www.ex.io": {URLs: 3, Redirects: 1, NoIndex: 1, MaxDepth: 1,
+			Links: 1, CrossLinks: 1},
+		"docs.ex.io": {URLs: 3, Errors: 1, Orphans: 1, Skipped: 1,
+			MaxDepth: 3, Links: 1},
+	}
+	if !reflect.DeepEqual(s.Hosts, want) {
+		for h, hs := range s.Hosts {
+			t.Errorf("Hosts[%s] = %+v, want %+v", h, hs, want[h])
+		}
+	}
+}
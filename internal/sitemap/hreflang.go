@@ -0,0 +1,105 @@
+package sitemap
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// XDefault is the hreflang of the page shown when no language matches
+const XDefault = "x-default"
+
+// hreflangRe matches an ISO 639-1 language code followed by an
+// optional script and an optional ISO 3166-1 region, i.e. zh-Hant-TW
+var hreflangRe = regexp.MustCompile(`(?i)^[a-z]{2}(-[a-z]{4})?(-[a-z]{2})?$`)
+
+// ValidHreflang tells whether lang is a valid hreflang value
+func ValidHreflang(lang string) bool {
+	return lang == XDefault || hreflangRe.MatchString(lang)
+}
+
+// AddAlternate records that page u declares alt as its version
+// for language lang
+// If u already declared an alternate for lang, first one is kept
+func (s *SiteMap) AddAlternate(u, lang, alt string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.Alternates == nil {
+		s.Alternates = make(map[string]map[string]string)
+	}
+	if _, ok := s.Alternates[u]; !ok {
+		s.Alternates[u] = make(map[string]string)
+	}
+	if _, ok := s.Alternates[u][lang]; !ok {
+		s.Alternates[u][lang] = alt
+	}
+}
+
+// CheckAlternates adds an issue to pages whose hreflang annotations
+// have invalid language codes or lack x-default, and to pages with
+// alternates which fail, redirect or don't link back to them
+// Alternates which were never fetched can't be checked and are ignored
+func (s *SiteMap) CheckAlternates() {
+	s.Lock()
+	defer s.Unlock()
+
+	for u, alts := range s.Alternates {
+		n, ok := s.URLs[u]
+		if !ok {
+			continue
+		}
+		if _, ok := alts[XDefault]; !ok {
+			n.Issues = append(n.Issues, "hreflang without x-default")
+		}
+		for _, lang := range sortedLangs(alts) {
+			alt := alts[lang]
+			if !ValidHreflang(lang) {
+				n.Issues = append(n.Issues,
+					fmt.Sprintf("invalid hreflang %q", lang))
+			}
+			if alt == u {
+				continue
+			}
+			an, ok := s.URLs[alt]
+			if !ok || (an.Fetch == nil && an.Error == "") {
+				// The alternate wasn't fetched
+				continue
+			}
+			switch {
+			case an.Error != "":
+				n.Issues = append(n.Issues, fmt.Sprintf("hreflang"+
+					" alternate %s fails: %s", alt, an.Error))
+			case an.Redirected():
+				n.Issues = append(n.Issues, fmt.Sprintf("hreflang"+
+					" alternate %s redirects", alt))
+			case an.Fetch.Status >= 400:
+				n.Issues = append(n.Issues, fmt.Sprintf("hreflang"+
+					" alternate %s gives %d", alt, an.Fetch.Status))
+			case !declares(s.Alternates[alt], u):
+				n.Issues = append(n.Issues, fmt.Sprintf("hreflang"+
+					" alternate %s has no return link", alt))
+			}
+		}
+	}
+}
+
+// declares tells whether alts contains u
+func declares(alts map[string]string, u string) bool {
+	for _, a := range alts {
+		if a == u {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedLangs gives the languages of alts in order
+func sortedLangs(alts map[string]string) []string {
+	langs := make([]string, 0, len(alts))
+	for l := range alts {
+		langs = append(langs, l)
+	}
+	sort.Strings(langs)
+	return langs
+}
@@ -0,0 +1,117 @@
+package sitemap
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/khrm/smap/internal/parser"
+)
+
+func TestValidHreflang(t *testing.T) {
+	tests := []struct {
+		lang string
+		want bool
+	}{
+		{"en", true},
+		{"en-GB", true},
+		{"zh-Hant-TW", true},
+		{"x-default", true},
+		{"en_GB", false},
+		{"english", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidHreflang(tt.lang); got != tt.want {
+			t.Errorf("ValidHreflang(%q) = %v, want %v", tt.lang, got,
+				tt.want)
+		}
+	}
+}
+
+func TestSiteMap_CheckAlternates(t *testing.T) {
+	ok := &parser.Fetch{Status: 200}
+	s := New()
+	for u, f := range map[string]*parser.Fetch{
+		"https://ex.io/en": ok,
+		"https://ex.io/fr": ok,
+		"https://ex.io/de": ok,
+		"https://ex.io/es": {Status: 404},
+		"https://ex.io/it": {Status: 301},
+		"https://ex.io/pt": nil,
+		"https://ex.io/nl": nil,
+	} {
+		s.AddURL(u, 0)
+		s.SetFetch(u, f)
+	}
+	s.URLs["https://ex.io/nl"].Error = "context deadline exceeded"
+	for _, a := range [][3]string{
+		{"https://ex.io/en", "x-default", "https://ex.io/en"},
+		{"https://ex.io/en", "en", "https://ex.io/en"},
+		{"https://ex.io/en", "fr", "https://ex.io/fr"},
+		{"https://ex.io/en", "de", "https://ex.io/de"},
+		{"https://ex.io/en", "es", "https://ex.io/es"},
+		{"https://ex.io/en", "it", "https://ex.io/it"},
+		{"https://ex.io/en", "pt", "https://ex.io/pt"},
+		{"https://ex.io/en", "nl", "https://ex.io/nl"},
+		{"https://ex.io/en", "en", "https://ex.io/ignored"},
+		{"https://ex.io/fr", "x-default", "https://ex.io/en"},
+		{"https://ex.io/fr", "fr_FR", "https://ex.io/fr"},
+		{"https://ex.io/de", "de", "https://ex.io/de"},
+	} {
+		s.AddAlternate(a[0], a[1], a[2])
+	}
+
+	s.CheckAlternates()
+
+	want := map[string][]string{
+		"https://ex.io/en": {
+			"hreflang alternate https://ex.io/de has no return link",
+			"hreflang alternate https://ex.io/es gives 404",
+			"hreflang alternate https://ex.io/it redirects",
+			"hreflang alternate https://ex.io/nl fails: context deadline" +
+				" exceeded",
+		},
+		"https://ex.io/fr": {`invalid hreflang "fr_FR"`},
+		"https://ex.io/de": {"hreflang without x-default"},
+	}
+	for u, n := range s.URLs {
+		if !reflect.DeepEqual(n.Issues, want[u]) {
+			t.Errorf("%s Issues = %q, want %q", u, n.Issues, want[u])
+		}
+	}
+
+	got, err := s.ToXMLSTDSiteMapConfig(&XMLConfig{Alternates: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantXML := `<urlset xmlns="https://www.sitemaps.org/schemas/sitemap/0.9"` +
+		` xmlns:xhtml="http://www.w3.org/1999/xhtml">` +
+		`<url><loc>https://ex.io/de</loc>` +
+		`<xhtml:link rel="alternate" hreflang="de" href="https://ex.io/de">` +
+		`</xhtml:link></url>` +
+		`<url><loc>https://ex.io/en</loc>` +
+		`<xhtml:link rel="alternate" hreflang="de" href="https://ex.io/de">` +
+		`</xhtml:link>` +
+		`<xhtml:link rel="alternate" hreflang="en" href="https://ex.io/en">` +
+		`</xhtml:link>` +
+		`<xhtml:link rel="alternate" hreflang="es" href="https://ex.io/es">` +
+		`</xhtml:link>` +
+		`<xhtml:link rel="alternate" hreflang="fr" href="https://ex.io/fr">` +
+		`</xhtml:link>` +
+		`<xhtml:link rel="alternate" hreflang="it" href="https://ex.io/it">` +
+		`</xhtml:link>` +
+		`<xhtml:link rel="alternate" hreflang="nl" href="https://ex.io/nl">` +
+		`</xhtml:link>` +
+		`<xhtml:link rel="alternate" hreflang="pt" href="https://ex.io/pt">` +
+		`</xhtml:link>` +
+		`<xhtml:link rel="alternate" hreflang="x-default"` +
+		` href="https://ex.io/en"></xhtml:link></url>` +
+		`<url><loc>https://ex.io/fr</loc>` +
+		`<xhtml:link rel="alternate" hreflang="x-default"` +
+		` href="https://ex.io/en"></xhtml:link></url>` +
+		`<url><loc>https://ex.io/pt</loc></url></urlset>`
+	if string(got) != wantXML {
+		t.Errorf("SiteMap.ToXMLSTDSiteMapConfig() = \n%s, want \n%s", got,
+			wantXML)
+	}
+}
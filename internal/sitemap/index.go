@@ -0,0 +1,300 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits of a sitemap file given by the sitemaps protocol
+const (
+	MaxURLsPerFile  = 50000
+	MaxBytesPerFile = 50 << 20
+)
+
+// IndexFile is the name of the sitemap index written by WriteFiles
+const IndexFile = "sitemap-index.xml"
+
+// IndexConfig tells WriteFiles where and how to write sitemap files
+type IndexConfig struct {
+	// Dir is the directory where files are written
+	Dir string
+	// BaseURL is the url where files are published, the index
+	// points at sitemaps under it
+	BaseURL string
+	// Gzip compresses sitemap files, the index is left as it is
+	Gzip bool
+	// MaxURLs and MaxBytes split sitemap files, they default
+	// to the protocol limits, MaxBytes is the uncompressed size
+	MaxURLs  int
+	MaxBytes int
+	// GroupBySection writes urls of every first path segment,
+	// i.e. /docs, in their own sitemap files
+	GroupBySection bool
+	// XML are the rules filling url entries, can be nil
+	XML *XMLConfig
+}
+
+// WriteFiles writes the standard sitemap split in numbered files
+// sitemap-N.xml (or sitemap-section-N.xml when grouped by section,
+// urls at the site root being in sitemap-N.xml)
+// along with the sitemap index IndexFile pointing at them
+// Urls of every host are written in their own files, named
+// sitemap-host-N.xml when there are several hosts
+// Sitemap files of Dir which aren't in the index are removed
+// It returns the names of the files written, index being the last one
+func (s *SiteMap) WriteFiles(c *IndexConfig) ([]string, error) {
+	maxURLs, maxBytes := c.MaxURLs, c.MaxBytes
+	if maxURLs <= 0 || maxURLs > MaxURLsPerFile {
+		maxURLs = MaxURLsPerFile
+	}
+	if maxBytes <= 0 || maxBytes > MaxBytesPerFile {
+		maxBytes = MaxBytesPerFile
+	}
+	base, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	groups := map[group][]xmlURL{}
+	hosts := map[string]struct{}{}
+	for _, u := range s.xmlURLs(c.XML) {
+		g := group{host: fileHost(u.Loc)}
+		if c.GroupBySection {
+			g.section = section(u.Loc)
+		}
+		groups[g] = append(groups[g], u)
+		hosts[g.host] = struct{}{}
+	}
+	keys := make([]group, 0, len(groups))
+	for g := range groups {
+		keys = append(keys, g)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].host != keys[j].host {
+			return keys[i].host < keys[j].host
+		}
+		return keys[i].section < keys[j].section
+	})
+
+	var files []string
+	var entries []xmlSitemap
+	for _, g := range keys {
+		for i, chunk := range split(groups[g], maxURLs, maxBytes) {
+			name := g.fileName(len(hosts) > 1, i+1)
+			if c.Gzip {
+				name += ".gz"
+			}
+			data, err := chunk.encode()
+			if err != nil {
+				return files, err
+			}
+			err = writeFile(filepath.Join(c.Dir, name), data, c.Gzip)
+			if err != nil {
+				return files, err
+			}
+			files = append(files, name)
+
+			loc := base.ResolveReference(&url.URL{Path: name})
+			entries = append(entries, xmlSitemap{
+				Loc:     loc.String(),
+				LastMod: chunk.lastMod,
+			})
+		}
+	}
+
+	index, err := xml.Marshal(struct {
+		XMLName   xml.Name     `xml:"sitemapindex"`
+		XMLnsAttr string       `xml:"xmlns,attr"`
+		Sitemap   []xmlSitemap `xml:"sitemap"`
+	}{XMLnsAttr: sitemapNS, Sitemap: entries})
+	if err != nil {
+		return files, err
+	}
+	err = writeFile(filepath.Join(c.Dir, IndexFile),
+		append([]byte(xml.Header), index...), false)
+	if err != nil {
+		return files, err
+	}
+	files = append(files, IndexFile)
+	return files, removeStale(c.Dir, files)
+}
+
+// removeStale removes the sitemap files of dir which aren't in files,
+// they were written by an earlier run and aren't in the index anymore
+func removeStale(dir string, files []string) error {
+	written := make(map[string]struct{}, len(files))
+	for _, f := range files {
+		written[f] = struct{}{}
+	}
+	for _, pattern := range []string{"sitemap-*.xml", "sitemap-*.xml.gz"} {
+		names, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if _, ok := written[filepath.Base(name)]; ok {
+				continue
+			}
+			if err := os.Remove(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// group is the host and section of the urls written in the
+// same sitemap files
+type group struct {
+	host, section string
+}
+
+// fileName gives the name of the i-th sitemap file of g,
+// the host is only named when urls of several hosts are written
+func (g group) fileName(hosts bool, i int) string {
+	parts := []string{"sitemap"}
+	if hosts {
+		parts = append(parts, g.host)
+	}
+	if g.section != "" {
+		parts = append(parts, g.section)
+	}
+	return strings.Join(append(parts, strconv.Itoa(i)), "-") + ".xml"
+}
+
+// fileHost gives the host of loc usable in a file name
+func fileHost(loc string) string {
+	return strings.Replace(strings.ToLower(host(loc)), ":", "_", -1)
+}
+
+// xmlSitemap is an entry of the sitemap index
+type xmlSitemap struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// chunk is the content of a sitemap file
+type chunk struct {
+	urls []xmlURL
+	// ext are the extensions used by urls
+	ext extensions
+	// size is the length of the file
+	size int
+	// lastMod is the most recent lastmod of urls
+	lastMod string
+}
+
+// split cuts urls in chunks of at most maxURLs entries whose
+// sitemap file is at most maxBytes long
+func split(urls []xmlURL, maxURLs, maxBytes int) []chunk {
+	var chunks []chunk
+	cur := chunk{size: urlsetSize(extensions{})}
+	for _, u := range urls {
+		b, err := xml.Marshal(struct {
+			XMLName xml.Name `xml:"url"`
+			xmlURL
+		}{xmlURL: u})
+		if err != nil {
+			continue
+		}
+		ext := cur.ext
+		ext.add(u)
+		size := cur.size - urlsetSize(cur.ext) + urlsetSize(ext) + len(b)
+		if len(cur.urls) > 0 && (len(cur.urls) == maxURLs ||
+			size > maxBytes) {
+			chunks = append(chunks, cur)
+			cur = chunk{}
+			ext = extensions{}
+			ext.add(u)
+			size = urlsetSize(ext) + len(b)
+		}
+		cur.urls = append(cur.urls, u)
+		cur.ext = ext
+		cur.size = size
+		if lastModTime(u.LastMod).After(lastModTime(cur.lastMod)) {
+			cur.lastMod = u.LastMod
+		}
+	}
+	if len(cur.urls) > 0 {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
+
+// lastModTime reads lastmod d given in W3C format, dates
+// which can't be read are zero
+func lastModTime(d string) time.Time {
+	for _, l := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(l, d); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// urlsetSize gives the length of a sitemap file without url entries
+func urlsetSize(e extensions) int {
+	b, _ := xml.Marshal(newURLSet(nil, e))
+	return len(xml.Header) + len(b)
+}
+
+// encode gives the sitemap file of c
+func (c chunk) encode() ([]byte, error) {
+	b, err := xml.Marshal(newURLSet(c.urls, c.ext))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+// section gives the first path segment of loc usable in a file name,
+// it's empty for urls at the site root so that they can't be grouped
+// with a segment
+func section(loc string) string {
+	u, err := url.Parse(loc)
+	if err != nil {
+		return ""
+	}
+	seg := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)[0]
+	seg = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, seg)
+	return seg
+}
+
+// writeFile writes data in name, gzipped if asked
+func writeFile(name string, data []byte, gz bool) error {
+	if !gz {
+		return ioutil.WriteFile(name, data, 0644)
+	}
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, b.Bytes(), 0644)
+}
@@ -0,0 +1,252 @@
+package sitemap
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSiteMap_WriteFiles(t *testing.T) {
+	s := &SiteMap{URLs: map[string]*Node{
+		"https://ex.io":        {},
+		"https://ex.io/blog/a": {Modified: "2018-08-01"},
+		"https://ex.io/blog/b": {Modified: "2018-09-01"},
+		"https://ex.io/docs/a": {},
+		"https://ex.io/docs/b": {},
+		"https://ex.io/docs/c": {},
+	}}
+
+	tests := []struct {
+		name   string
+		config IndexConfig
+		want   []string
+		index  []string
+	}{
+		{
+			"split by urls",
+			IndexConfig{BaseURL: "https://ex.io/maps", MaxURLs: 4},
+			[]string{"sitemap-1.xml", "sitemap-2.xml", IndexFile},
+			[]string{"<loc>https://ex.io/maps/sitemap-1.xml</loc>" +
+				"<lastmod>2018-09-01</lastmod>",
+				"<loc>https://ex.io/maps/sitemap-2.xml</loc></sitemap>"},
+		},
+		{
+			"split by size",
+			IndexConfig{BaseURL: "https://ex.io/", MaxBytes: 180},
+			[]string{"sitemap-1.xml", "sitemap-2.xml", "sitemap-3.xml",
+				"sitemap-4.xml", "sitemap-5.xml", "sitemap-6.xml",
+				IndexFile},
+			[]string{"<loc>https://ex.io/sitemap-6.xml</loc>"},
+		},
+		{
+			"grouped and gzipped",
+			IndexConfig{BaseURL: "https://ex.io/", Gzip: true,
+				GroupBySection: true, MaxURLs: 2},
+			[]string{"sitemap-1.xml.gz", "sitemap-blog-1.xml.gz",
+				"sitemap-docs-1.xml.gz", "sitemap-docs-2.xml.gz",
+				IndexFile},
+			[]string{"<loc>https://ex.io/sitemap-docs-2.xml.gz</loc>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "smap")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			tt.config.Dir = dir
+			got, err := s.WriteFiles(&tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SiteMap.WriteFiles() = %v, want %v", got, tt.want)
+			}
+
+			index, err := ioutil.ReadFile(filepath.Join(dir, IndexFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.index {
+				if !strings.Contains(string(index), w) {
+					t.Errorf("index %s doesn't contain %s", index, w)
+				}
+			}
+
+			urls := 0
+			for _, name := range got[:len(got)-1] {
+				b := readFile(t, filepath.Join(dir, name), tt.config.Gzip)
+				if tt.config.MaxBytes > 0 && len(b) > tt.config.MaxBytes {
+					t.Errorf("%s is %d bytes long, want at most %d",
+						name, len(b), tt.config.MaxBytes)
+				}
+				urls += strings.Count(string(b), "<url>")
+			}
+			if urls != len(s.URLs) {
+				t.Errorf("files contain %d urls, want %d", urls,
+					len(s.URLs))
+			}
+		})
+	}
+}
+
+func Test_section(t *testing.T) {
+	tests := []struct {
+		loc  string
+		want string
+	}{
+		{"https://ex.io", ""},
+		{"https://ex.io/", ""},
+		{"https://ex.io/page", "page"},
+		{"https://ex.io/Docs/a", "docs"},
+		{"https://ex.io/root/a", "root"},
+		{"https://ex.io/a.b c/", "a-b-c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.loc, func(t *testing.T) {
+			if got := section(tt.loc); got != tt.want {
+				t.Errorf("section() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func readFile(t *testing.T, name string, gz bool) []byte {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if !gz {
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSiteMap_WriteFilesHosts(t *testing.T) {
+	s := &SiteMap{URLs: map[string]*Node{
+		"https://ex.io":           {},
+		"https://ex.io/docs/a":    {},
+		"https://www.ex.io/":      {},
+		"http://ex.io:8080/docs/": {},
+	}}
+	dir, err := ioutil.TempDir("", "smap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	got, err := s.WriteFiles(&IndexConfig{Dir: dir,
+		BaseURL: "https://ex.io/", GroupBySection: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"sitemap-ex.io-1.xml", "sitemap-ex.io-docs-1.xml",
+		"sitemap-ex.io_8080-docs-1.xml", "sitemap-www.ex.io-1.xml",
+		IndexFile}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SiteMap.WriteFiles() = %v, want %v", got, want)
+	}
+	for name, loc := range map[string]string{
+		"sitemap-ex.io-1.xml":           "https://ex.io",
+		"sitemap-ex.io_8080-docs-1.xml": "http://ex.io:8080/docs/",
+		"sitemap-www.ex.io-1.xml":       "https://www.ex.io/",
+	} {
+		b := readFile(t, filepath.Join(dir, name), false)
+		if n := strings.Count(string(b), "<url>"); n != 1 ||
+			!strings.Contains(string(b), "<loc>"+loc+"</loc>") {
+			t.Errorf("%s = %s, want only %s", name, b, loc)
+		}
+	}
+}
+
+func TestSiteMap_WriteFilesStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"sitemap-1.xml", "sitemap-2.xml",
+		"sitemap-docs-1.xml.gz", "sitemap.xml", "robots.txt"} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &SiteMap{URLs: map[string]*Node{"https://ex.io": {}}}
+	_, err = s.WriteFiles(&IndexConfig{Dir: dir, BaseURL: "https://ex.io/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, fi := range infos {
+		got = append(got, fi.Name())
+	}
+	want := []string{"robots.txt", "sitemap-1.xml", IndexFile,
+		"sitemap.xml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	b := readFile(t, filepath.Join(dir, "sitemap-1.xml"), false)
+	if len(b) == 0 {
+		t.Error("sitemap-1.xml wasn't overwritten")
+	}
+}
+
+func Test_split(t *testing.T) {
+	tests := []struct {
+		name    string
+		urls    []xmlURL
+		lastMod string
+	}{
+		{
+			"dates",
+			[]xmlURL{{LastMod: "2018-08-01"}, {LastMod: "2018-09-01"}},
+			"2018-09-01",
+		},
+		{
+			"time zones",
+			[]xmlURL{{LastMod: "2018-09-01"},
+				{LastMod: "2018-08-31T23:30:00-05:00"},
+				{LastMod: "2018-09-01T02:00:00Z"}},
+			"2018-08-31T23:30:00-05:00",
+		},
+		{
+			"unset",
+			[]xmlURL{{LastMod: "2018-08-01T10:00:00+02:00"}, {}},
+			"2018-08-01T10:00:00+02:00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := split(tt.urls, MaxURLsPerFile, MaxBytesPerFile)
+			if len(got) != 1 || got[0].lastMod != tt.lastMod {
+				t.Errorf("split() = %v, want one chunk with lastmod %s",
+					got, tt.lastMod)
+			}
+		})
+	}
+}
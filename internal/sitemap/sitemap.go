@@ -1,68 +1,264 @@
 package sitemap
 
 import (
-	"encoding/xml"
 	"sync"
+
+	"github.com/khrm/smap/internal/linkcheck"
+	"github.com/khrm/smap/internal/parser"
 )
 
 // SiteMap DataStructure containing urls and connections
 // SiteMap is just a graph
 type SiteMap struct {
-	URLs        map[string]struct{}
-	Connections map[string]map[string]struct{}
+	URLs        map[string]*Node
+	Connections map[string]map[string]Edge
+	// Resources contains urls used by a page but not crawled
+	// like images, scripts and stylesheets
+	Resources map[string]map[string]struct{} `json:",omitempty"`
+	// Skipped contains urls which were found but not crawled
+	// along with the reason, i.e. blocked by robots
+	Skipped map[string]string `json:",omitempty"`
+	// Sitemaps are the sitemap urls announced by the crawled hosts
+	Sitemaps map[string]struct{} `json:",omitempty"`
+	// Canonicals are the canonical clusters, pages by the canonical
+	// url they declare
+	Canonicals map[string]map[string]struct{} `json:",omitempty"`
+	// Hosts are the figures of every host, they are set by Summarize
+	Hosts map[string]*HostSummary `json:",omitempty"`
+	// Alternates are the language clusters declared by pages with
+	// hreflang annotations, by page then by language
+	Alternates map[string]map[string]string `json:",omitempty"`
+	// External are the results of the checks of urls out of the
+	// crawl scope which are linked from crawled pages
+	External map[string]*linkcheck.Result `json:",omitempty"`
+	// Changes are the differences with a previous crawl,
+	// they are set by Compare
+	Changes *Changes `json:",omitempty"`
 	sync.Mutex
 }
 
+// Node contains the details known about a url in the sitemap
+type Node struct {
+	// Depth is the click depth of the url from the root url
+	Depth int
+	// Fetch are the details of the response got for the url,
+	// nil if it wasn't fetched
+	Fetch *parser.Fetch `json:",omitempty"`
+	// Error is the reason the url couldn't be fetched when no
+	// response was got, i.e. a timeout
+	Error string `json:",omitempty"`
+	// Attempts is the number of times the url was fetched when
+	// it was retried
+	Attempts int `json:",omitempty"`
+	// Title is the title of the page
+	Title string `json:",omitempty"`
+	// Modified is the last modification date declared by the page
+	Modified string `json:",omitempty"`
+	// Issues are the problems found with the url, i.e. a redirect loop
+	Issues []string `json:",omitempty"`
+	// InSitemap is set when the url is listed in a published sitemap
+	InSitemap bool `json:",omitempty"`
+	// Orphan is set when the url was only found in a published
+	// sitemap, no link to it was found from the root
+	Orphan bool `json:",omitempty"`
+	// Canonical is the canonical url declared by the page
+	Canonical string `json:",omitempty"`
+	// Anchors are the ids and a names of the page
+	Anchors []string `json:",omitempty"`
+	// SkippedLinks are the links of the page which weren't crawled,
+	// they are listed in Skipped along with the reason
+	SkippedLinks []string `json:",omitempty"`
+	// NoIndex and NoFollow are the robots directives of the page
+	NoIndex  bool `json:",omitempty"`
+	NoFollow bool `json:",omitempty"`
+	// Images, Videos and News are the media of the page,
+	// their urls are absolute
+	Images []parser.Image `json:",omitempty"`
+	Videos []parser.Video `json:",omitempty"`
+	News   *parser.News   `json:",omitempty"`
+}
+
+// Redirected tells whether the url answered with a redirection
+func (n *Node) Redirected() bool {
+	return n.Fetch != nil && n.Fetch.Status >= 300 && n.Fetch.Status < 400
+}
+
+// Indexable tells whether url u of the node can be listed in a sitemap,
+// it must answer without redirecting nor failing, not be noindex and
+// be its own canonical
+func (n *Node) Indexable(u string) bool {
+	if n.Redirected() || n.NoIndex || n.Error != "" {
+		return false
+	}
+	if n.Fetch != nil && n.Fetch.Status >= 400 {
+		return false
+	}
+	return n.Canonical == "" || n.Canonical == u
+}
+
+// EdgeType tells how a url leads to another
+type EdgeType string
+
+const (
+	// EdgeLink is a link found in the document, it's the zero value
+	EdgeLink EdgeType = ""
+	// EdgeRedirect is a http redirection
+	EdgeRedirect EdgeType = "redirect"
+	// EdgeAlternate is a hreflang annotation
+	EdgeAlternate EdgeType = "alternate"
+	// EdgeExternal is a link to a url out of the crawl scope
+	EdgeExternal EdgeType = "external"
+)
+
+// Edge contains details of a connection between two urls
+type Edge struct {
+	Type EdgeType `json:",omitempty"`
+	// Status is the status code of a redirection
+	Status int `json:",omitempty"`
+	// Text is the anchor text of a link
+	Text string `json:",omitempty"`
+	// Fragments are the fragments of the links, i.e. section for
+	// /docs#section, along with the anchor text of their link
+	Fragments map[string]string `json:",omitempty"`
+}
+
 // New Gives an instance of SiteMap
 func New() *SiteMap {
 	return &SiteMap{
-		URLs:        make(map[string]struct{}),
-		Connections: make(map[string]map[string]struct{}),
+		URLs:        make(map[string]*Node),
+		Connections: make(map[string]map[string]Edge),
 	}
 }
 
-// AddURL add a new url in the sitemap
+// AddURL add a new url in the sitemap found at given click depth
 // If url already exist, then it returns false
-func (s *SiteMap) AddURL(url string) bool {
+func (s *SiteMap) AddURL(url string, depth int) bool {
 	s.Lock()
 	defer s.Unlock()
 	if _, ok := s.URLs[url]; ok {
 		return false
 	}
-	s.URLs[url] = struct{}{}
+	s.URLs[url] = &Node{Depth: depth}
 	return true
 }
 
+// SetFetch records the response details got for url
+// It does nothing if url isn't in the sitemap
+func (s *SiteMap) SetFetch(url string, f *parser.Fetch) {
+	s.Lock()
+	defer s.Unlock()
+	if n, ok := s.URLs[url]; ok {
+		n.Fetch = f
+	}
+}
+
+// UpdateNode calls f with the node of url under lock
+// It returns false if url isn't in the sitemap
+func (s *SiteMap) UpdateNode(url string, f func(n *Node)) bool {
+	s.Lock()
+	defer s.Unlock()
+	n, ok := s.URLs[url]
+	if ok {
+		f(n)
+	}
+	return ok
+}
+
+// AddIssue records a problem found with url
+// It does nothing if url isn't in the sitemap
+func (s *SiteMap) AddIssue(url, issue string) {
+	s.Lock()
+	defer s.Unlock()
+	if n, ok := s.URLs[url]; ok {
+		n.Issues = append(n.Issues, issue)
+	}
+}
+
 // AddConnection add a new connection from u to v in the sitemap
 // If connection already exist, then it returns true,false
 // It also returns false,false if any node doesn't already exists
 func (s *SiteMap) AddConnection(u, v string) {
+	s.AddEdge(u, v, Edge{})
+}
+
+// AddEdge add a new connection from u to v with details e
+// An existing redirect edge isn't replaced by a link, links to v
+// already found only add their fragments to the edge
+func (s *SiteMap) AddEdge(u, v string, e Edge) {
 	s.Lock()
 	defer s.Unlock()
 
 	if _, ok := s.Connections[u]; !ok {
-		s.Connections[u] = make(map[string]struct{})
+		s.Connections[u] = make(map[string]Edge)
+	}
+	if old, ok := s.Connections[u][v]; ok && e.Type == EdgeLink {
+		// Fragments of every link from u to v are kept
+		for f, text := range e.Fragments {
+			if old.Fragments == nil {
+				old.Fragments = make(map[string]string)
+			}
+			if _, ok := old.Fragments[f]; !ok {
+				old.Fragments[f] = text
+			}
+		}
+		e = old
+	}
+	s.Connections[u][v] = e
+}
+
+// AddResource records v as a resource used by page u
+func (s *SiteMap) AddResource(u, v string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.Resources == nil {
+		s.Resources = make(map[string]map[string]struct{})
+	}
+	if _, ok := s.Resources[u]; !ok {
+		s.Resources[u] = make(map[string]struct{})
+	}
+	s.Resources[u][v] = struct{}{}
+}
+
+// AddSkipped records url as found but not crawled because of reason
+// If url was already skipped, first reason is kept
+func (s *SiteMap) AddSkipped(url, reason string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.Skipped == nil {
+		s.Skipped = make(map[string]string)
+	}
+	if _, ok := s.Skipped[url]; !ok {
+		s.Skipped[url] = reason
 	}
-	s.Connections[u][v] = struct{}{}
 }
 
-// ToXMLSTDSiteMap gives you standardise sitemap give root url
-func (s *SiteMap) ToXMLSTDSiteMap() ([]byte, error) {
-	xsm := struct {
-		XMLName   xml.Name `xml:"urlset"`
-		XMLnsAttr string   `xml:"xmlns,attr"`
-		URL       []struct {
-			Loc string `xml:"loc"`
-		} `xml:"url"`
-	}{
-		XMLnsAttr: "https://www.sitemaps.org/schemas/sitemap/0.9",
+// AddCanonical records that page u declares canonical as its
+// canonical url
+func (s *SiteMap) AddCanonical(u, canonical string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if n, ok := s.URLs[u]; ok {
+		n.Canonical = canonical
 	}
-	for i := range s.URLs {
-		xsm.URL = append(xsm.URL, struct {
-			Loc string `xml:"loc"`
-		}{i})
+	if s.Canonicals == nil {
+		s.Canonicals = make(map[string]map[string]struct{})
 	}
+	if _, ok := s.Canonicals[canonical]; !ok {
+		s.Canonicals[canonical] = make(map[string]struct{})
+	}
+	s.Canonicals[canonical][u] = struct{}{}
+}
 
-	return xml.Marshal(xsm)
+// AddSitemap records a sitemap url announced by a site
+func (s *SiteMap) AddSitemap(url string) {
+	s.Lock()
+	defer s.Unlock()
 
+	if s.Sitemaps == nil {
+		s.Sitemaps = make(map[string]struct{})
+	}
+	s.Sitemaps[url] = struct{}{}
 }
@@ -3,6 +3,8 @@ package sitemap
 import (
 	"reflect"
 	"testing"
+
+	"github.com/khrm/smap/internal/parser"
 )
 
 // TestNew test the constructor of SiteMap
@@ -15,8 +17,8 @@ func TestNew(t *testing.T) {
 		{
 			"TestNew 1",
 			&SiteMap{
-				URLs:        make(map[string]struct{}),
-				Connections: make(map[string]map[string]struct{}),
+				URLs:        make(map[string]*Node),
+				Connections: make(map[string]map[string]Edge),
 			},
 		},
 	}
@@ -32,8 +34,8 @@ func TestNew(t *testing.T) {
 // TestSiteMap_AddURL test function AddURL
 func TestSiteMap_AddURL(t *testing.T) {
 	type fields struct {
-		URLs        map[string]struct{}
-		Connections map[string]map[string]struct{}
+		URLs        map[string]*Node
+		Connections map[string]map[string]Edge
 	}
 	type args struct {
 		url string
@@ -49,9 +51,9 @@ func TestSiteMap_AddURL(t *testing.T) {
 		{
 			name: "TestSiteMap_AddURL - 1 pos",
 			fields: fields{
-				URLs: make(map[string]struct{}),
+				URLs: make(map[string]*Node),
 				Connections: make(
-					map[string]map[string]struct{}),
+					map[string]map[string]Edge),
 			},
 			args: args{nURL},
 			want: true,
@@ -59,9 +61,9 @@ func TestSiteMap_AddURL(t *testing.T) {
 		{
 			name: "TestSiteMap_AddURL - 2 neg",
 			fields: fields{
-				URLs: map[string]struct{}{eURL: {}},
+				URLs: map[string]*Node{eURL: {}},
 				Connections: make(
-					map[string]map[string]struct{}),
+					map[string]map[string]Edge),
 			},
 			args: args{eURL},
 			want: false,
@@ -73,7 +75,7 @@ func TestSiteMap_AddURL(t *testing.T) {
 				URLs:        tt.fields.URLs,
 				Connections: tt.fields.Connections,
 			}
-			if got := s.AddURL(tt.args.url); got != tt.want {
+			if got := s.AddURL(tt.args.url, 0); got != tt.want {
 				t.Errorf("SiteMap.AddURL() = %v, want %v", got, tt.want)
 			}
 		})
@@ -83,8 +85,8 @@ func TestSiteMap_AddURL(t *testing.T) {
 // TestSiteMap_AddConnection test AddConnection to SiteMap
 func TestSiteMap_AddConnection(t *testing.T) {
 	type fields struct {
-		URLs        map[string]struct{}
-		Connections map[string]map[string]struct{}
+		URLs        map[string]*Node
+		Connections map[string]map[string]Edge
 	}
 	type args struct {
 		u string
@@ -94,10 +96,10 @@ func TestSiteMap_AddConnection(t *testing.T) {
 	a := "URL a"
 	b := "URL b"
 	fieldsWithNoConnection := fields{
-		URLs: map[string]struct{}{a: {},
+		URLs: map[string]*Node{a: {},
 			b: {}},
 		Connections: make(
-			map[string]map[string]struct{}),
+			map[string]map[string]Edge),
 	}
 
 	tests := []struct {
@@ -114,9 +116,9 @@ func TestSiteMap_AddConnection(t *testing.T) {
 				v: b,
 			},
 			want: &SiteMap{
-				URLs: map[string]struct{}{a: {}, b: {}},
-				Connections: map[string]map[string]struct{}{
-					a: {b: struct{}{}},
+				URLs: map[string]*Node{a: {}, b: {}},
+				Connections: map[string]map[string]Edge{
+					a: {b: {}},
 				},
 			},
 		},
@@ -138,14 +140,20 @@ func TestSiteMap_AddConnection(t *testing.T) {
 
 func TestSiteMap_ToXMLSTDSiteMap(t *testing.T) {
 	type fields struct {
-		URLs        map[string]struct{}
-		Connections map[string]map[string]struct{}
+		URLs        map[string]*Node
+		Connections map[string]map[string]Edge
 	}
 
 	f := fields{
-		URLs: map[string]struct{}{"https://exA": {}},
+		URLs: map[string]*Node{
+			"https://exA": {},
+			"https://exB": {Fetch: &parser.Fetch{Status: 301}},
+			"https://exC": {NoIndex: true},
+			"https://exD": {Canonical: "https://exA"},
+			"https://exE": {Fetch: &parser.Fetch{Status: 500}},
+		},
 		Connections: make(
-			map[string]map[string]struct{}),
+			map[string]map[string]Edge),
 	}
 
 	want := `<urlset xmlns="https://www.sitemaps.org/schemas/sitemap/0.9">` +
@@ -181,3 +189,66 @@ func TestSiteMap_ToXMLSTDSiteMap(t *testing.T) {
 		})
 	}
 }
+
+// TestSiteMap_AddSkipped test AddSkipped keeps the first reason
+func TestSiteMap_AddSkipped(t *testing.T) {
+	s := New()
+	s.AddSkipped("URL a", "reason 1")
+	s.AddSkipped("URL a", "reason 2")
+
+	want := map[string]string{"URL a": "reason 1"}
+	if !reflect.DeepEqual(s.Skipped, want) {
+		t.Errorf("SiteMap.Skipped = %v, want %v", s.Skipped, want)
+	}
+}
+
+// TestSiteMap_AddEdge test a link doesn't replace a redirection
+func TestSiteMap_AddEdge(t *testing.T) {
+	s := New()
+	r := Edge{Type: EdgeRedirect, Status: 301}
+	s.AddEdge("a", "b", r)
+	s.AddConnection("a", "b")
+
+	if got := s.Connections["a"]["b"]; !reflect.DeepEqual(got, r) {
+		t.Errorf("SiteMap.Connections[a][b] = %v, want %v", got, r)
+	}
+}
+
+// TestSiteMap_AddEdgeFragments test fragments of links are merged
+func TestSiteMap_AddEdgeFragments(t *testing.T) {
+	s := New()
+	s.AddEdge("a", "b", Edge{Text: "first",
+		Fragments: map[string]string{"x": "first"}})
+	s.AddEdge("a", "b", Edge{Text: "second"})
+	s.AddEdge("a", "b", Edge{Text: "third",
+		Fragments: map[string]string{"y": "third", "x": "third"}})
+
+	want := Edge{Text: "first",
+		Fragments: map[string]string{"x": "first", "y": "third"}}
+	if got := s.Connections["a"]["b"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("SiteMap.Connections[a][b] = %v, want %v", got, want)
+	}
+}
+
+// TestSiteMap_AddCanonical test pages are grouped by canonical url
+func TestSiteMap_AddCanonical(t *testing.T) {
+	s := New()
+	s.AddURL("a", 0)
+	s.AddURL("a?page=1", 1)
+	s.AddCanonical("a", "a")
+	s.AddCanonical("a?page=1", "a")
+	s.AddCanonical("b", "a")
+
+	want := map[string]map[string]struct{}{
+		"a": {"a": {}, "a?page=1": {}, "b": {}},
+	}
+	if !reflect.DeepEqual(s.Canonicals, want) {
+		t.Errorf("SiteMap.Canonicals = %v, want %v", s.Canonicals, want)
+	}
+	if c := s.URLs["a?page=1"].Canonical; c != "a" {
+		t.Errorf("Node.Canonical = %q, want a", c)
+	}
+	if !s.URLs["a"].Indexable("a") || s.URLs["a?page=1"].Indexable("a?page=1") {
+		t.Errorf("Node.Indexable() want true for a, false for a?page=1")
+	}
+}
@@ -0,0 +1,231 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// changeFreqs are the values allowed for changefreq
+var changeFreqs = map[string]struct{}{
+	"always":  {},
+	"hourly":  {},
+	"daily":   {},
+	"weekly":  {},
+	"monthly": {},
+	"yearly":  {},
+	"never":   {},
+}
+
+// FreqRule sets changefreq of urls matching Pattern
+type FreqRule struct {
+	Pattern *regexp.Regexp
+	Freq    string
+}
+
+// PriorityRule sets priority of urls matching Pattern
+type PriorityRule struct {
+	Pattern  *regexp.Regexp
+	Priority float64
+}
+
+// XMLConfig contains the rules used to fill url entries of
+// the standard sitemap, first matching rule wins
+type XMLConfig struct {
+	ChangeFreq []FreqRule
+	Priority   []PriorityRule
+	// DepthPriority gives urls matching no priority rule a priority
+	// computed from their click depth, 1.0 for the root and 0.2
+	// less for every level down to 0.1
+	DepthPriority bool
+	// Images and Videos add image:image and video:video entries
+	// for the media found in pages
+	Images bool
+	Videos bool
+	// News adds news:news entries for pages declaring a publication
+	// date, NewsPublication names the publication of pages which
+	// don't declare it
+	News            bool
+	NewsPublication string
+	// Alternates adds xhtml:link entries for the hreflang
+	// alternates declared by pages
+	Alternates bool
+}
+
+// ParseFreqRule reads a rule written as regexp=changefreq
+func ParseFreqRule(v string) (FreqRule, error) {
+	re, value, err := splitRule(v)
+	if err != nil {
+		return FreqRule{}, err
+	}
+	if _, ok := changeFreqs[value]; !ok {
+		return FreqRule{}, fmt.Errorf("invalid changefreq %q", value)
+	}
+	return FreqRule{Pattern: re, Freq: value}, nil
+}
+
+// ParsePriorityRule reads a rule written as regexp=priority
+func ParsePriorityRule(v string) (PriorityRule, error) {
+	re, value, err := splitRule(v)
+	if err != nil {
+		return PriorityRule{}, err
+	}
+	p, err := strconv.ParseFloat(value, 64)
+	if err != nil || p < 0 || p > 1 {
+		return PriorityRule{}, fmt.Errorf("invalid priority %q", value)
+	}
+	return PriorityRule{Pattern: re, Priority: p}, nil
+}
+
+// splitRule splits a rule on its last =
+func splitRule(v string) (*regexp.Regexp, string, error) {
+	i := strings.LastIndex(v, "=")
+	if i < 0 {
+		return nil, "", fmt.Errorf("rule %q isn't written as"+
+			" regexp=value", v)
+	}
+	re, err := regexp.Compile(v[:i])
+	if err != nil {
+		return nil, "", err
+	}
+	return re, strings.TrimSpace(v[i+1:]), nil
+}
+
+// sitemapNS is the xmlns of urlset and sitemapindex
+const sitemapNS = "https://www.sitemaps.org/schemas/sitemap/0.9"
+
+// xmlURL is an url entry of the standard sitemap
+type xmlURL struct {
+	Loc        string     `xml:"loc"`
+	LastMod    string     `xml:"lastmod,omitempty"`
+	ChangeFreq string     `xml:"changefreq,omitempty"`
+	Priority   string     `xml:"priority,omitempty"`
+	Images     []xmlImage `xml:"image:image"`
+	Videos     []xmlVideo `xml:"video:video"`
+	News       *xmlNews   `xml:"news:news"`
+	Alternates []xmlLink  `xml:"xhtml:link"`
+}
+
+// ToXMLSTDSiteMap gives you standardise sitemap give root url
+// Urls which aren't indexable are left out, i.e. redirections,
+// noindex pages and pages having another canonical url
+func (s *SiteMap) ToXMLSTDSiteMap() ([]byte, error) {
+	return s.ToXMLSTDSiteMapConfig(nil)
+}
+
+// ToXMLSTDSiteMapConfig is like ToXMLSTDSiteMap but fills changefreq
+// and priority following c, c can be nil
+// Urls are sorted so that the output is the same between runs
+func (s *SiteMap) ToXMLSTDSiteMapConfig(c *XMLConfig) ([]byte, error) {
+	urls := s.xmlURLs(c)
+	var e extensions
+	for _, u := range urls {
+		e.add(u)
+	}
+	return xml.Marshal(newURLSet(urls, e))
+}
+
+// xmlURLs gives the url entries of the standard sitemap sorted by loc
+func (s *SiteMap) xmlURLs(c *XMLConfig) []xmlURL {
+	if c == nil {
+		c = &XMLConfig{}
+	}
+
+	locs := make([]string, 0, len(s.URLs))
+	for u, n := range s.URLs {
+		if n != nil && !n.Indexable(u) {
+			continue
+		}
+		locs = append(locs, u)
+	}
+	sort.Strings(locs)
+
+	urls := make([]xmlURL, 0, len(locs))
+	for _, u := range locs {
+		n := s.URLs[u]
+		if n == nil {
+			n = &Node{}
+		}
+		urls = append(urls, xmlURL{
+			Loc:        u,
+			LastMod:    n.LastMod(),
+			ChangeFreq: c.changeFreq(u),
+			Priority:   c.priority(u, n.Depth),
+			Images:     c.images(n),
+			Videos:     c.videos(n),
+			News:       c.news(n),
+			Alternates: c.alternates(s, u),
+		})
+	}
+	return urls
+}
+
+func (c *XMLConfig) changeFreq(u string) string {
+	for _, r := range c.ChangeFreq {
+		if r.Pattern.MatchString(u) {
+			return r.Freq
+		}
+	}
+	return ""
+}
+
+func (c *XMLConfig) priority(u string, depth int) string {
+	for _, r := range c.Priority {
+		if r.Pattern.MatchString(u) {
+			return strconv.FormatFloat(r.Priority, 'f', -1, 64)
+		}
+	}
+	if !c.DepthPriority {
+		return ""
+	}
+	p := 1.0 - 0.2*float64(depth)
+	if p < 0.1 {
+		p = 0.1
+	}
+	return strconv.FormatFloat(p, 'f', 1, 64)
+}
+
+// dateLayouts are the layouts tried to read a date declared in a page
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	time.RFC1123,
+	time.RFC1123Z,
+}
+
+// LastMod gives the last modification date of the url in W3C format
+// It's taken from the Last-Modified header, or else from the date
+// declared in the page, and it's empty if none can be read
+func (n *Node) LastMod() string {
+	if n.Fetch != nil && n.Fetch.LastModified != "" {
+		if t, err := http.ParseTime(n.Fetch.LastModified); err == nil {
+			return t.UTC().Format(time.RFC3339)
+		}
+	}
+	return w3cDate(n.Modified)
+}
+
+// w3cDate gives a date written in a page in W3C format,
+// it's empty if it can't be read
+func w3cDate(d string) string {
+	d = strings.TrimSpace(d)
+	if d == "" {
+		return ""
+	}
+	for _, l := range dateLayouts {
+		if t, err := time.Parse(l, d); err == nil {
+			if l == "2006-01-02" {
+				return t.Format(l)
+			}
+			return t.Format(time.RFC3339)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+package sitemap
+
+import (
+	"testing"
+
+	"github.com/khrm/smap/internal/parser"
+)
+
+func TestSiteMap_ToXMLSTDSiteMapConfig(t *testing.T) {
+	s := &SiteMap{URLs: map[string]*Node{
+		"https://ex.io/docs/b": {Depth: 2, Modified: "2018-08-01"},
+		"https://ex.io/blog": {Depth: 1, Fetch: &parser.Fetch{
+			Status: 200, LastModified: "Wed, 21 Oct 2015 07:28:00 GMT"}},
+		"https://ex.io":        {Depth: 0},
+		"https://ex.io/docs/a": {Depth: 5},
+		"https://ex.io/dead": {Depth: 1,
+			Error: "context deadline exceeded", Attempts: 3},
+	}}
+
+	c := &XMLConfig{DepthPriority: true}
+	fr, err := ParseFreqRule("/blog=daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ChangeFreq = append(c.ChangeFreq, fr)
+	for _, v := range []string{"/docs/a$=0.9", "/docs/b$=0.25"} {
+		pr, err := ParsePriorityRule(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Priority = append(c.Priority, pr)
+	}
+
+	want := `<urlset xmlns="https://www.sitemaps.org/schemas/sitemap/0.9">` +
+		`<url><loc>https://ex.io</loc><priority>1.0</priority></url>` +
+		`<url><loc>https://ex.io/blog</loc>` +
+		`<lastmod>2015-10-21T07:28:00Z</lastmod>` +
+		`<changefreq>daily</changefreq><priority>0.8</priority></url>` +
+		`<url><loc>https://ex.io/docs/a</loc><priority>0.9</priority></url>` +
+		`<url><loc>https://ex.io/docs/b</loc><lastmod>2018-08-01</lastmod>` +
+		`<priority>0.25</priority></url>` +
+		`</urlset>`
+
+	got, err := s.ToXMLSTDSiteMapConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("SiteMap.ToXMLSTDSiteMapConfig() = \n%s, want \n%s", got,
+			want)
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	bad := []string{"nofreq", "/a=sometimes", "(=daily"}
+	for _, v := range bad {
+		if _, err := ParseFreqRule(v); err == nil {
+			t.Errorf("ParseFreqRule(%q) error = nil, want error", v)
+		}
+	}
+	bad = []string{"/a=2", "/a=high"}
+	for _, v := range bad {
+		if _, err := ParsePriorityRule(v); err == nil {
+			t.Errorf("ParsePriorityRule(%q) error = nil, want error", v)
+		}
+	}
+}
+
+func TestNode_LastMod(t *testing.T) {
+	tests := []struct {
+		name string
+		node Node
+		want string
+	}{
+		{"none", Node{}, ""},
+		{"meta", Node{Modified: "2018-08-07T10:00:00+02:00"},
+			"2018-08-07T10:00:00+02:00"},
+		{"invalid meta", Node{Modified: "yesterday"}, ""},
+		{"header wins", Node{Modified: "2018-08-07",
+			Fetch: &parser.Fetch{LastModified: "Wed, 21 Oct 2015 07:28:00 GMT"}},
+			"2015-10-21T07:28:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.node.LastMod(); got != tt.want {
+				t.Errorf("Node.LastMod() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+// Package throttle spaces out and limits requests made to every host
+package throttle
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/khrm/smap/internal/retry"
+)
+
+// defaultMaxDelay caps the delay added by backoff when
+// Config.MaxDelay isn't set
+const defaultMaxDelay = time.Minute
+
+// minBackoff is the first delay added when a host answers 429 or 503
+// without Retry-After
+const minBackoff = time.Second
+
+// transportClient defines the interface needed to make requests
+type transportClient interface {
+	Do(req *http.Request) (resp *http.Response, err error)
+}
+
+// Config tells how requests to a host are limited, zero values
+// mean no limit
+type Config struct {
+	// MaxPerHost is the number of requests in flight to a host
+	MaxPerHost int
+	// RPS is the number of requests started per second to a host
+	RPS float64
+	// MinDelay is the time between the start of two requests to a host
+	MinDelay time.Duration
+	// Adaptive slows down requests to a host whose latency climbs
+	Adaptive bool
+	// MaxDelay caps the delay added by backoff, one minute if unset
+	MaxDelay time.Duration
+}
+
+// Client makes requests with client limiting them per host
+// Hosts answering 429 or 503 are backed off, honoring Retry-After
+type Client struct {
+	client transportClient
+	c      Config
+	log    *log.Logger
+	debug  bool
+
+	// now and sleep are the clock of the schedule of requests
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu    sync.Mutex
+	hosts map[string]*host
+}
+
+// host is the state of the requests made to a host
+type host struct {
+	// slots holds a value for every request in flight, nil if
+	// they aren't limited
+	slots chan struct{}
+	// next is the earliest time the next request can start
+	next time.Time
+	// backoff is the delay added between requests by backoff
+	backoff time.Duration
+	// latency is the moving average of response times and
+	// baseline the lowest one seen
+	latency, baseline time.Duration
+	// delay is the time between two requests asked by the host,
+	// i.e. the Crawl-delay of its robots.txt
+	delay time.Duration
+	// waited counts the requests booked by Wait, Do doesn't book
+	// them again
+	waited int
+}
+
+// New gives an instance of Client
+func New(client transportClient, c Config, l *log.Logger,
+	debug bool) *Client {
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = defaultMaxDelay
+	}
+	return &Client{
+		client: client,
+		c:      c,
+		log:    l,
+		debug:  debug,
+		now:    time.Now,
+		sleep:  retry.Sleep,
+		hosts:  make(map[string]*host),
+	}
+}
+
+// Wait books the start of a request to host name and waits for it,
+// so that callers limiting requests over all hosts can take their
+// slot once it's over instead of holding it while the host is held back
+// The next request made by Do to that host starts without waiting
+func (c *Client) Wait(ctx context.Context, name string) error {
+	h := c.host(name)
+	if err := c.sleep(ctx, c.reserve(h)); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h.waited++
+	return nil
+}
+
+// Do waits for req to be allowed for its host and makes it
+// The slot taken for the host is released once the response
+// body is closed
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	h := c.host(req.URL.Host)
+
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if h.slots != nil {
+			<-h.slots
+		}
+	}
+
+	if !c.booked(h) {
+		if err := c.sleep(ctx, c.reserve(h)); err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	start := c.now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	c.feedback(req.URL.Host, h, resp, c.now().Sub(start))
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// host gives the state of host name, creating it if needed
+func (c *Client) host(name string) *host {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.hosts[name]
+	if !ok {
+		h = &host{}
+		if c.c.MaxPerHost > 0 {
+			h.slots = make(chan struct{}, c.c.MaxPerHost)
+		}
+		c.hosts[name] = h
+	}
+	return h
+}
+
+// SetHostDelay sets the time asked by host name between the start of
+// two requests, i.e. the Crawl-delay of its robots.txt
+// MinDelay and RPS still apply when they space requests more
+func (c *Client) SetHostDelay(name string, d time.Duration) {
+	h := c.host(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h.delay = d
+}
+
+// interval gives the time between the start of two requests
+// to h, without backoff
+func (c *Client) interval(h *host) time.Duration {
+	d := c.c.MinDelay
+	if h.delay > d {
+		d = h.delay
+	}
+	if c.c.RPS > 0 {
+		if r := time.Duration(float64(time.Second) / c.c.RPS); r > d {
+			d = r
+		}
+	}
+	return d
+}
+
+// reserve books the next start time of a request to h
+// and gives how long to wait for it
+func (c *Client) reserve(h *host) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	at := h.next
+	if at.Before(now) {
+		at = now
+	}
+	h.next = at.Add(c.interval(h) + h.backoff)
+	return at.Sub(now)
+}
+
+// booked tells whether the start of a request to h was already
+// booked by Wait, using the booking
+func (c *Client) booked(h *host) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if h.waited == 0 {
+		return false
+	}
+	h.waited--
+	return true
+}
+
+// feedback adapts the delay of host h to resp which took elapsed
+func (c *Client) feedback(name string, h *host, resp *http.Response,
+	elapsed time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusServiceUnavailable {
+		wait, ok := RetryAfter(resp, c.now())
+		if !ok {
+			h.backoff = c.cap(2 * h.backoff)
+			if h.backoff < minBackoff {
+				h.backoff = c.cap(minBackoff)
+			}
+			wait = h.backoff
+		}
+		wait = c.cap(wait)
+		if next := c.now().Add(wait); next.After(h.next) {
+			h.next = next
+		}
+		if c.debug {
+			c.log.Printf("host %s answered %d, waiting %s", name,
+				resp.StatusCode, wait)
+		}
+		return
+	}
+
+	if h.latency == 0 {
+		h.latency = elapsed
+	} else {
+		h.latency = (4*h.latency + elapsed) / 5
+	}
+	if h.baseline == 0 || h.latency < h.baseline {
+		h.baseline = h.latency
+	}
+
+	switch {
+	case c.c.Adaptive && h.latency > 2*h.baseline:
+		h.backoff = c.cap(h.backoff + h.latency)
+		if c.debug {
+			c.log.Printf("host %s slows down to %s, waiting %s between"+
+				" requests", name, h.latency, h.backoff)
+		}
+	case h.backoff > 0:
+		h.backoff /= 2
+		if h.backoff < 10*time.Millisecond {
+			h.backoff = 0
+		}
+	}
+}
+
+// cap limits d to MaxDelay
+func (c *Client) cap(d time.Duration) time.Duration {
+	if d > c.c.MaxDelay {
+		return c.c.MaxDelay
+	}
+	return d
+}
+
+// RetryAfter gives how long to wait as asked by the Retry-After
+// header of resp, given in seconds or as a date
+func RetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// releaseBody releases the slot of a request once its body is closed
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
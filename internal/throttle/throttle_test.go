@@ -0,0 +1,280 @@
+package throttle
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock whose sleeps move its time forward at once
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (f *fakeClock) now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.t
+}
+
+func (f *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if d > 0 {
+		f.t = f.t.Add(d)
+	}
+	return nil
+}
+
+// withClock makes c schedule requests on clock
+func withClock(c *Client, clock *fakeClock) *Client {
+	c.now = clock.now
+	c.sleep = clock.sleep
+	return c
+}
+
+// fakeClient answers status after delay and counts requests in flight
+// Starts are read on clock when it's set
+type fakeClient struct {
+	status int
+	header http.Header
+	delay  time.Duration
+	clock  *fakeClock
+
+	mu       sync.Mutex
+	inFlight int
+	max      int
+	starts   []time.Time
+}
+
+func (f *fakeClient) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	if f.clock != nil {
+		start = f.clock.now()
+	}
+	f.mu.Lock()
+	f.inFlight++
+	if f.inFlight > f.max {
+		f.max = f.inFlight
+	}
+	f.starts = append(f.starts, start)
+	f.mu.Unlock()
+
+	time.Sleep(f.delay)
+
+	f.mu.Lock()
+	f.inFlight--
+	f.mu.Unlock()
+	return &http.Response{
+		StatusCode: f.status,
+		Header:     f.header,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+func get(t *testing.T, c *Client, link string) {
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func TestClient_MaxPerHost(t *testing.T) {
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	f := &fakeClient{status: 200, delay: 10 * time.Millisecond}
+	c := New(f, Config{MaxPerHost: 2}, l, true)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			get(t, c, "https://ex.io/")
+		}()
+	}
+	wg.Wait()
+
+	if f.max != 2 {
+		t.Errorf("max requests in flight = %d, want 2", f.max)
+	}
+}
+
+func TestClient_MinDelay(t *testing.T) {
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	clock := &fakeClock{t: time.Now()}
+	f := &fakeClient{status: 200, clock: clock}
+	c := withClock(New(f, Config{MinDelay: 30 * time.Millisecond,
+		RPS: 100}, l, true), clock)
+
+	get(t, c, "https://ex.io/a")
+	get(t, c, "https://other.io/a")
+	get(t, c, "https://ex.io/b")
+
+	if d := f.starts[1].Sub(f.starts[0]); d != 0 {
+		t.Errorf("other host waited %s", d)
+	}
+	if d := f.starts[2].Sub(f.starts[0]); d != 30*time.Millisecond {
+		t.Errorf("same host waited %s, want 30ms", d)
+	}
+}
+
+func TestClient_SetHostDelay(t *testing.T) {
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	clock := &fakeClock{t: time.Now()}
+	f := &fakeClient{status: 200, clock: clock}
+	c := withClock(New(f, Config{MinDelay: 10 * time.Millisecond}, l,
+		true), clock)
+	c.SetHostDelay("ex.io", 40*time.Millisecond)
+
+	get(t, c, "https://ex.io/a")
+	get(t, c, "https://ex.io/b")
+	get(t, c, "https://other.io/a")
+	get(t, c, "https://other.io/b")
+
+	if d := f.starts[1].Sub(f.starts[0]); d != 40*time.Millisecond {
+		t.Errorf("host with a delay waited %s, want 40ms", d)
+	}
+	if d := f.starts[3].Sub(f.starts[2]); d != 10*time.Millisecond {
+		t.Errorf("other host waited %s, want MinDelay", d)
+	}
+}
+
+func TestClient_WaitSchedule(t *testing.T) {
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	clock := &fakeClock{t: time.Now()}
+	f := &fakeClient{status: 200, clock: clock}
+	c := withClock(New(f, Config{}, l, true), clock)
+	c.SetHostDelay("ex.io", 50*time.Millisecond)
+
+	for _, link := range []string{"https://ex.io/a", "https://ex.io/b",
+		"https://ex.io/c"} {
+		if err := c.Wait(context.Background(), "ex.io"); err != nil {
+			t.Fatal(err)
+		}
+		get(t, c, link)
+	}
+
+	for i := 1; i < len(f.starts); i++ {
+		if d := f.starts[i].Sub(f.starts[i-1]); d != 50*time.Millisecond {
+			t.Errorf("request %d started %s after the previous one,"+
+				" want 50ms", i, d)
+		}
+	}
+}
+
+func TestClient_Wait(t *testing.T) {
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	f := &fakeClient{status: 200}
+	c := New(f, Config{MinDelay: time.Hour}, l, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		100*time.Millisecond)
+	defer cancel()
+	if err := c.Wait(ctx, "ex.io"); err != nil {
+		t.Fatalf("Client.Wait() error = %v", err)
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet,
+		"https://ex.io/", nil)
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Client.Do() after Wait error = %v, want no wait", err)
+	}
+	resp.Body.Close()
+	if err := c.Wait(ctx, "ex.io"); err != context.DeadlineExceeded {
+		t.Errorf("Client.Wait() error = %v, want %v", err,
+			context.DeadlineExceeded)
+	}
+}
+
+func TestClient_Backoff(t *testing.T) {
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"retry after", http.Header{"Retry-After": {"7"}}, 7 * time.Second},
+		{"no retry after", http.Header{}, minBackoff},
+		{"capped", http.Header{"Retry-After": {"3600"}}, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeClient{status: http.StatusTooManyRequests,
+				header: tt.header}
+			c := New(f, Config{}, l, true)
+			start := time.Now()
+			get(t, c, "https://ex.io/")
+
+			wait := c.hosts["ex.io"].next.Sub(start)
+			if wait < tt.want || wait > tt.want+time.Second {
+				t.Errorf("next request in %s, want %s", wait, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_Adaptive(t *testing.T) {
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	f := &fakeClient{status: 200, delay: time.Millisecond}
+	c := New(f, Config{Adaptive: true}, l, true)
+
+	get(t, c, "https://ex.io/")
+	f.delay = 50 * time.Millisecond
+	get(t, c, "https://ex.io/")
+	if b := c.hosts["ex.io"].backoff; b == 0 {
+		t.Errorf("backoff = 0 when latency climbs")
+	}
+}
+
+func TestClient_Cancelled(t *testing.T) {
+	l := log.New(ioutil.Discard, "logger: ", log.Lshortfile)
+	f := &fakeClient{status: 200}
+	c := New(f, Config{MinDelay: time.Hour}, l, true)
+	get(t, c, "https://ex.io/")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet,
+		"https://ex.io/", nil)
+	if _, err := c.Do(req); err != context.Canceled {
+		t.Errorf("Client.Do() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2018, 8, 7, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		v      string
+		want   time.Duration
+		wantOk bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"Tue, 07 Aug 2018 10:00:30 GMT", 30 * time.Second, true},
+		{"Tue, 07 Aug 2018 09:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{"Retry-After": {tt.v}}}
+		got, ok := RetryAfter(resp, now)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("RetryAfter(%q) = %s, %v, want %s, %v", tt.v, got, ok,
+				tt.want, tt.wantOk)
+		}
+	}
+}